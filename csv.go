@@ -7,70 +7,236 @@
 package csv
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
 	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
 	"golang.org/x/text/encoding/unicode"
 )
 
+// noRune marks an optional rune (e.g. prefix, suffix and comment) as not set.
+// It is only compared against the rules, never against the scanned runes
+// alone, so NUL in the document is still treated as normal content.
 const noRune = '\x00'
 
+// encodings is the registry of encodings which can be referred to by name.
+// Names are compared after being normalized with normalizeEncodingName.
+var encodings = map[string]encoding.Encoding{
+	"utf8":        unicode.UTF8,
+	"utf16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"shiftjis":    japanese.ShiftJIS,
+	"eucjp":       japanese.EUCJP,
+	"iso2022jp":   japanese.ISO2022JP,
+	"euckr":       korean.EUCKR,
+	"gbk":         simplifiedchinese.GBK,
+	"gb18030":     simplifiedchinese.GB18030,
+	"big5":        traditionalchinese.Big5,
+	"windows1252": charmap.Windows1252,
+	"iso88591":    charmap.ISO8859_1,
+	"latin1":      charmap.ISO8859_1,
+}
+
+// EncodingByName returns the encoding with the given name. Names are case
+// insensitive, and '-' and '_' in names are ignored. Supported names are
+// "utf-8", "utf-16le", "utf-16be", "shift_jis", "euc-jp", "iso-2022-jp",
+// "euc-kr", "gbk", "gb18030", "big5", "windows-1252", "iso-8859-1" and
+// "latin1".
+func EncodingByName(name string) (encoding.Encoding, error) {
+	enc, exist := encodings[normalizeEncodingName(name)]
+	if !exist {
+		return nil, fmt.Errorf("csv: unknown encoding %s", name)
+	}
+	return enc, nil
+}
+
+// normalizeEncodingName lowercases name and removes all '-' and '_' in it, so
+// that "Shift_JIS", "shift-jis" and "shiftjis" refer to the same encoding.
+func normalizeEncodingName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
 type rule struct {
 	// Common rules.
-	encoding  encoding.Encoding
-	separator rune
-	prefix    rune
-	suffix    rune
+	encoding         encoding.Encoding
+	separator        rune
+	separatorString  string // Separator of more than one rune, empty if not set.
+	quote            rune
+	escapeChar       rune
+	prefix           rune
+	suffix           rune
+	compression      CompressionFormat
+	escapedSeparator bool
+	err              error // Error of an invalid setting, returned when the rule is used.
 
 	// Scanner rules.
 	allowSingleQuote                 bool
 	allowEmptyField                  bool
+	rejectTrailingSeparator          bool
+	trailingQuote                    TrailingQuoteBehavior
 	allowEndingLineBreakInLastRecord bool
+	allowCRLineEnd                   bool
 	omitLeadingSpace                 bool
 	omitTrailingSpace                bool
 	omitEmptyLine                    bool
 	comment                          rune
+	trailingComment                  bool
+	skipRows                         int
+	reuseRecord                      bool
 	ignoreBOM                        bool
+	rawQuotes                        bool
+	optionalAffix                    bool
+	allowMissingColumns              bool
+	progressEvery                    int
+	progress                         func(records int)
+	requireValidUTF8                 bool
+	fieldTransform                   func(col int, field string) string
+	paragraphMode                    bool
+	columnTypes                      map[int]ColumnType
+	normalizeToHeader                bool
+	truncateLongRows                 bool
+	emptyLineIsRecord                bool
+	maxTotalBytes                    int
+	singleLineFields                 bool
+	fieldsPerRecord                  int
+
+	// Generator rules.
+	lineTerminator       string
+	writeEndingLineBreak bool
+	quoteAll             bool
+	quoteEmpty           bool
+	writeBOM             bool
+	verifyRoundTrip      bool
+	padColumns           bool
+	nullToken            string
+	emptyFieldOutput     string
 
 	// Unmarshaler and marshaler common rules.
-	headerPrefix rune
-	headerSuffix rune
-	fieldPrefix  rune
-	fieldSuffix  rune
+	headerPrefix    rune
+	headerSuffix    rune
+	headerSeparator rune
+	fieldPrefix     rune
+	fieldSuffix     rune
+	tagKey          string
 
 	// Unmarshaler rules.
-	validators map[string]func(interface{}) bool
+	validators             map[string]func(interface{}) bool
+	rawValidators          map[string]func(string) bool
+	header                 bool
+	headerNames            []string
+	validateHeader         func(header []string) error
+	intOverflow            OverflowBehavior
+	continueOnError        bool
+	headerCaseInsensitive  bool
+	disallowUnknownColumns bool
 
 	// Marshaler rules.
-	writeHeader bool
+	writeHeader    bool
+	timeLocation   *time.Location
+	virtualColumns []virtualColumn
+	translators    map[string]func(interface{}) ([]byte, error)
+	floatFormat    byte
+	floatPrecision int
+	rounding       Rounding
+}
+
+// A virtualColumn is a column computed from a struct while marshaling, instead
+// of being a field of it.
+type virtualColumn struct {
+	name string
+	fn   func(v interface{}) (string, error)
 }
 
 var defaultRule = rule{
 	// Common rules.
-	encoding:  unicode.UTF8,
-	separator: ',',
-	prefix:    noRune,
-	suffix:    noRune,
+	encoding:         unicode.UTF8,
+	separator:        ',',
+	separatorString:  "",
+	quote:            '"',
+	escapeChar:       noRune,
+	prefix:           noRune,
+	suffix:           noRune,
+	compression:      NoCompression,
+	escapedSeparator: false,
+	err:              nil,
 
 	// Scanner rules.
 	allowSingleQuote:                 true,
 	allowEmptyField:                  true,
+	rejectTrailingSeparator:          false,
+	trailingQuote:                    TrailingQuoteAllow,
 	allowEndingLineBreakInLastRecord: true,
+	allowCRLineEnd:                   false,
 	omitLeadingSpace:                 true,
 	omitTrailingSpace:                true,
 	omitEmptyLine:                    true,
 	comment:                          noRune,
+	trailingComment:                  false,
+	skipRows:                         0,
+	reuseRecord:                      false,
 	ignoreBOM:                        true,
+	rawQuotes:                        false,
+	optionalAffix:                    false,
+	allowMissingColumns:              false,
+	progressEvery:                    0,
+	progress:                         nil,
+	requireValidUTF8:                 false,
+	fieldTransform:                   nil,
+	paragraphMode:                    false,
+	columnTypes:                      nil,
+	normalizeToHeader:                false,
+	truncateLongRows:                 false,
+	emptyLineIsRecord:                false,
+	maxTotalBytes:                    0,
+	singleLineFields:                 false,
+	fieldsPerRecord:                  -1,
+
+	// Generator rules.
+	lineTerminator:       "\n",
+	writeEndingLineBreak: false,
+	quoteAll:             false,
+	quoteEmpty:           false,
+	writeBOM:             false,
+	verifyRoundTrip:      false,
+	padColumns:           false,
+	nullToken:            "",
+	emptyFieldOutput:     "",
 
 	// Unmarshaler and marshaler common rules.
-	headerPrefix: noRune,
-	headerSuffix: noRune,
-	fieldPrefix:  noRune,
-	fieldSuffix:  noRune,
+	headerPrefix:    noRune,
+	headerSuffix:    noRune,
+	headerSeparator: noRune,
+	fieldPrefix:     noRune,
+	fieldSuffix:     noRune,
+	tagKey:          csvTagName,
 
 	// Unmarshaler rules.
-	validators: nil,
+	validators:             nil,
+	rawValidators:          nil,
+	header:                 true,
+	headerNames:            nil,
+	validateHeader:         nil,
+	intOverflow:            OverflowError,
+	continueOnError:        false,
+	headerCaseInsensitive:  false,
+	disallowUnknownColumns: false,
 
 	// Marshaler rules.
-	writeHeader: true,
+	writeHeader:    true,
+	timeLocation:   time.UTC,
+	virtualColumns: nil,
+	translators:    nil,
+	floatFormat:    'f',
+	floatPrecision: -1,
+	rounding:       RoundNearest,
 }
 
 // A Setting provides information on how documents should be parsed.
@@ -87,10 +253,78 @@ func Encoding(enc encoding.Encoding) Setting {
 	}
 }
 
+// EncodingName sets the character encoding used while reading and writing a
+// document by its name. See EncodingByName for supported names. If the name is
+// unknown, an error will be returned when the settings are used.
+func EncodingName(name string) Setting {
+	return func(r *rule) {
+		enc, err := EncodingByName(name)
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.encoding = enc
+	}
+}
+
 // Separator sets the separator used to separate fields while reading and writing a document.
 func Separator(sep rune) Setting {
 	return func(r *rule) {
-		r.separator = sep
+		r.setSeparator(sep)
+	}
+}
+
+// SeparatorString sets a separator of one or more runes, e.g. "||", used to
+// separate fields while reading and writing a document. If sep is empty, an
+// error will be returned when the settings are used.
+//
+// While writing a document, a field containing any rune of a separator of more
+// than one rune is quoted, so that a field ending with a part of the separator
+// is read back correctly. Such separators are never escaped with the
+// EscapedSeparator setting.
+func SeparatorString(sep string) Setting {
+	return func(r *rule) {
+		if sep == "" {
+			r.err = fmt.Errorf("csv: empty separator")
+			return
+		}
+		if utf8.RuneCountInString(sep) == 1 {
+			r.setSeparator([]rune(sep)[0])
+			return
+		}
+		r.separator, _ = utf8.DecodeRuneInString(sep)
+		r.separatorString = sep
+	}
+}
+
+// Quote sets the quote of fields while reading and writing a document. The
+// default is '"'. A quote inside a quoted field is escaped by doubling it, e.g.
+// with Quote('`'), a backtick in a field is written as two backticks.
+//
+// Quote works together with AllowSingleQuote: if single quotes are allowed,
+// a field starting with a single quote is also read as a quoted field.
+func Quote(quote rune) Setting {
+	return func(r *rule) {
+		r.quote = quote
+	}
+}
+
+// EscapeChar sets the rune which escapes the next rune inside a quoted field
+// while reading and writing a document, e.g. EscapeChar('\\') for the backslash
+// escapes used by MySQL and PostgreSQL exports. By default, no escape rune is
+// set and a quote is escaped only by doubling it.
+//
+// With EscapeChar('\\'), the sequences \n, \r and \t in a quoted field are read
+// as a line feed, a carriage return and a tab, and a backslash followed by any
+// other rune is read as that rune, e.g. \" as a quote and \\ as a backslash.
+// Doubled quotes are still accepted. A backslash at the end of the document is
+// read as it is.
+//
+// While writing a document, quotes and escape runes in a quoted field are
+// escaped with the escape rune instead of being doubled.
+func EscapeChar(escape rune) Setting {
+	return func(r *rule) {
+		r.escapeChar = escape
 	}
 }
 
@@ -108,11 +342,47 @@ func Suffix(suffix rune) Setting {
 	}
 }
 
+// A CompressionFormat is a compression format of documents.
+type CompressionFormat int
+
+// Supported compression formats.
+const (
+	NoCompression CompressionFormat = iota
+	Gzip
+)
+
+// Compression sets the compression format used while reading and writing a
+// document. The scanner decompresses the data before scanning, and the
+// generator compresses the document written to it.
+func Compression(c CompressionFormat) Setting {
+	return func(r *rule) {
+		r.compression = c
+	}
+}
+
+// EscapedSeparator sets whether a separator preceded by a backslash is a part of
+// an unquoted field instead of the end of it while reading and writing a
+// document. For example, a\,b will be read as a single field "a,b".
+//
+// While writing a document, separators in fields are escaped with backslashes
+// instead of quoting the fields, unless the fields have to be quoted for other
+// reasons or could not be escaped unambiguously.
+func EscapedSeparator(v bool) Setting {
+	return func(r *rule) {
+		r.escapedSeparator = v
+	}
+}
+
 //==============================================================================
 // Scanner settings.
 //==============================================================================
 
 // AllowSingleQuote sets whether single quotes are allowed while reading a document.
+//
+// A field quoted with single quotes is escaped in the same way as one quoted
+// with double quotes, i.e. a single quote in it is doubled. Double quotes in it
+// are literal characters and are not unescaped, e.g. 'a""b' is read as a""b,
+// and so are single quotes in a field quoted with double quotes.
 func AllowSingleQuote(v bool) Setting {
 	return func(r *rule) {
 		r.allowSingleQuote = v
@@ -126,6 +396,38 @@ func AllowEmptyField(v bool) Setting {
 	}
 }
 
+// RejectTrailingSeparator sets whether a record ending with a separator, e.g.
+// "a,b,c,", should cause an error while reading a document. The empty last
+// field left by a trailing separator is often a bug of the exporting program.
+// Empty fields elsewhere, and a quoted empty last field, are still allowed.
+func RejectTrailingSeparator(v bool) Setting {
+	return func(r *rule) {
+		r.rejectTrailingSeparator = v
+	}
+}
+
+// A TrailingQuoteBehavior describes how a quote at the end of an unquoted
+// field, e.g. `abc"`, is handled while reading a document.
+type TrailingQuoteBehavior int
+
+// Supported trailing quote behaviors.
+const (
+	// TrailingQuoteAllow keeps the quote as a part of the field.
+	TrailingQuoteAllow TrailingQuoteBehavior = iota
+	// TrailingQuoteError returns an error for the field, since the quote is
+	// likely a malformed quoting attempt.
+	TrailingQuoteError
+)
+
+// TrailingQuote sets how a quote at the end of an unquoted field is handled
+// while reading a document. Quotes elsewhere in an unquoted field, e.g.
+// `ab"c`, are always kept as a part of the field.
+func TrailingQuote(v TrailingQuoteBehavior) Setting {
+	return func(r *rule) {
+		r.trailingQuote = v
+	}
+}
+
 // AllowEndingLineBreakInLastRecord sets whether the last record may have an
 // ending line break while reading a document.
 func AllowEndingLineBreakInLastRecord(v bool) Setting {
@@ -134,6 +436,16 @@ func AllowEndingLineBreakInLastRecord(v bool) Setting {
 	}
 }
 
+// AllowCRLineEnd sets whether a bare \r should be treated as a line end while
+// reading a document, as in documents from classic Mac OS. If not, a bare \r
+// is a part of the field. A bare \r in a quoted field is always a part of it,
+// and \r\n is always treated as a line end.
+func AllowCRLineEnd(v bool) Setting {
+	return func(r *rule) {
+		r.allowCRLineEnd = v
+	}
+}
+
 // OmitLeadingSpace sets whether the leading spaces of fields should be omitted
 // while reading a document.
 func OmitLeadingSpace(v bool) Setting {
@@ -157,15 +469,78 @@ func OmitEmptyLine(v bool) Setting {
 	}
 }
 
+// EmptyLineIsRecord sets whether an empty line should be read as a record with
+// a single empty field while reading a document. If set, empty lines are not
+// omitted regardless of the OmitEmptyLine setting, and are not rejected by the
+// AllowEmptyField setting. The line break at the end of the last record still
+// does not start a new record.
+func EmptyLineIsRecord(v bool) Setting {
+	return func(r *rule) {
+		r.emptyLineIsRecord = v
+	}
+}
+
 // Comment sets the leading rune of comments used while reading a document.
+//
+// While writing a document, a record whose first field starts with the comment
+// rune is quoted, so that it is not read as a comment.
 func Comment(comment rune) Setting {
 	return func(r *rule) {
 		r.comment = comment
 	}
 }
 
+// TrailingComment sets whether a comment may also start after the fields of a
+// record while reading a document, e.g. "a,b,c # note" is read as a, b and c
+// with Comment('#'). The record ends at the first comment rune out of quoted
+// fields, and the rest of the line is skipped. The comment rune inside a quoted
+// field is a part of the field. It has no effect if no comment rune is set
+// with the Comment setting.
+//
+// While writing a document, a field containing the comment rune is quoted.
+func TrailingComment(v bool) Setting {
+	return func(r *rule) {
+		r.trailingComment = v
+	}
+}
+
+// SkipRows sets the number of lines discarded at the start of a document
+// before reading it, e.g. report titles or export timestamps above the header.
+// The lines are counted as they are in the document, including empty lines
+// and comments, regardless of the OmitEmptyLine and Comment settings. Line
+// numbers in errors still count the skipped lines.
+//
+// n must not be negative.
+func SkipRows(n int) Setting {
+	return func(r *rule) {
+		if n < 0 {
+			r.err = fmt.Errorf("csv: negative number of rows to skip %d", n)
+			return
+		}
+		r.skipRows = n
+	}
+}
+
+// ReuseRecord sets whether Scan, ScanWithHash, ScanFunc and Rows may return a
+// row backed by the same slice as the previous row, so that a new slice is not
+// allocated for every row, like the ReuseRecord field of encoding/csv.Reader.
+//
+// If set, a returned row is only valid until the next row is scanned, which
+// overwrites its fields. The fields themselves are strings and remain valid,
+// so copy the row, not the fields, if it is needed later. ScanAll and other
+// methods returning all the rows at once always return separate rows.
+func ReuseRecord(v bool) Setting {
+	return func(r *rule) {
+		r.reuseRecord = v
+	}
+}
+
 // IgnoreBOM sets whether the leading BOM (byte order mark) should be ignored
 // while reading a document. If not, the BOM will be treated as normal content.
+// Both a UTF-8 BOM and a UTF-16 BOM decoded with the Encoding setting are
+// ignored. A BOM at the start of a line where a record starts, which is left by
+// concatenating documents, is also ignored, while one at the start of a line
+// inside a quoted field is kept.
 //
 // This should not be done by a csv package, but since Golang has no built-in
 // support for BOM, a workaround is required.
@@ -175,6 +550,274 @@ func IgnoreBOM(v bool) Setting {
 	}
 }
 
+// RawQuotes sets whether quoted fields should be returned verbatim while
+// reading a document, with the surrounding quotes and the escaping quotes kept
+// in the field. For example, "aa""a" will be returned as is instead of aa"a.
+func RawQuotes(v bool) Setting {
+	return func(r *rule) {
+		r.rawQuotes = v
+	}
+}
+
+// OptionalAffix sets whether the prefix and suffix of fields may be missing
+// while reading a document. If so, a field without the prefix or suffix is
+// scanned as is, instead of causing an error.
+func OptionalAffix(v bool) Setting {
+	return func(r *rule) {
+		r.optionalAffix = v
+	}
+}
+
+// AllowMissingColumns sets whether columns missing in a record should be
+// returned as empty fields while scanning selected columns with
+// Scanner.ScanInto. If not, an error will be returned.
+func AllowMissingColumns(v bool) Setting {
+	return func(r *rule) {
+		r.allowMissingColumns = v
+	}
+}
+
+// Progress sets a function to be called every n records while reading a
+// document, with the number of records read so far. The unmarshaler counts
+// only data rows, not the header row.
+func Progress(every int, fn func(records int)) Setting {
+	return func(r *rule) {
+		r.progressEvery = every
+		r.progress = fn
+	}
+}
+
+// RequireValidUTF8 sets whether every field must be valid UTF-8 after being
+// decoded while reading a document. If not, an error with the position of the
+// field will be returned.
+//
+// Invalid bytes are decoded as U+FFFD (the replacement character), so a field
+// containing U+FFFD is also treated as invalid. This catches documents read
+// with a wrong encoding.
+func RequireValidUTF8(v bool) Setting {
+	return func(r *rule) {
+		r.requireValidUTF8 = v
+	}
+}
+
+// FieldTransform sets a function to transform every field while reading a
+// document, e.g. to trim or normalize it. fn is called with the column index
+// and the content of each field after it is unquoted, and the returned value
+// is used instead. The header row read by Scanner.ScanAllWithHeader and
+// Unmarshal is not transformed. fn is never called concurrently, even by
+// Scanner.ParallelScanAll, which scans with a single goroutine if fn is set.
+func FieldTransform(fn func(col int, field string) string) Setting {
+	return func(r *rule) {
+		r.fieldTransform = fn
+	}
+}
+
+// ParagraphMode sets whether each line should be read as a field, and records
+// be separated by blank lines while reading a document. In paragraph mode,
+// fields are not unquoted, the Separator, Prefix and Suffix settings are not
+// used, and lines starting with the comment rune are skipped.
+func ParagraphMode(v bool) Setting {
+	return func(r *rule) {
+		r.paragraphMode = v
+	}
+}
+
+// A ColumnType is the type of the fields in a column, which is checked by
+// Scanner.Validate, or inferred by Scanner.InferTypes.
+type ColumnType int
+
+// Supported column types.
+const (
+	StringColumn ColumnType = iota // Any field.
+	IntColumn                      // Integers in base 10.
+	FloatColumn                    // Floating point numbers.
+	BoolColumn                     // Boolean values accepted by strconv.ParseBool.
+	DateColumn                     // Dates in the form of "2006-01-02".
+)
+
+func (t ColumnType) String() string {
+	switch t {
+	case StringColumn:
+		return "string"
+	case IntColumn:
+		return "int"
+	case FloatColumn:
+		return "float"
+	case BoolColumn:
+		return "bool"
+	case DateColumn:
+		return "date"
+	}
+	return fmt.Sprintf("ColumnType(%d)", int(t))
+}
+
+// ColumnTypes sets the expected types of columns checked by Scanner.Validate.
+// The key of types is the column index. Columns not in types are not checked.
+func ColumnTypes(types map[int]ColumnType) Setting {
+	return func(r *rule) {
+		r.columnTypes = types
+	}
+}
+
+// NormalizeToHeader sets whether every data row should have the same number of
+// fields as the header while scanning a document with
+// Scanner.ScanAllWithHeader or unmarshaling it. Short rows are padded with
+// empty fields. Long rows cause an error, unless the TruncateLongRows setting
+// is enabled.
+func NormalizeToHeader(v bool) Setting {
+	return func(r *rule) {
+		r.normalizeToHeader = v
+	}
+}
+
+// TruncateLongRows sets whether data rows with more fields than the header
+// should be truncated instead of causing an error, if the NormalizeToHeader
+// setting is enabled.
+func TruncateLongRows(v bool) Setting {
+	return func(r *rule) {
+		r.truncateLongRows = v
+	}
+}
+
+// MaxTotalBytes sets the maximum number of bytes of all the fields kept by
+// Scanner.ScanAll and Scanner.ScanAllWithHeader, which are also used while
+// unmarshaling a document. If the limit is exceeded, ErrResultTooLarge will be
+// returned. 0 means no limit.
+//
+// The limit guards against documents which are valid but too large to be kept
+// in memory as a whole.
+func MaxTotalBytes(n int) Setting {
+	return func(r *rule) {
+		r.maxTotalBytes = n
+	}
+}
+
+// SingleLineFields asserts that no quoted field in the document contains line
+// breaks, so that Scanner.ParallelScanAll can split a document containing
+// quotes at line breaks. If the assertion is wrong, the rows scanned by
+// ParallelScanAll are wrong.
+func SingleLineFields(singleLine bool) Setting {
+	return func(r *rule) {
+		r.singleLineFields = singleLine
+	}
+}
+
+// FieldsPerRecord sets the number of fields in each record while reading a
+// document, in the same way as the FieldsPerRecord field of encoding/csv's
+// Reader. If n is positive, each record must have n fields. If n is 0, each
+// record must have the same number of fields as the first one. If n is
+// negative, records may have any number of fields. Records in paragraph mode
+// are not checked.
+//
+// Unlike encoding/csv, the number is not checked by default, i.e. it is -1.
+func FieldsPerRecord(n int) Setting {
+	return func(r *rule) {
+		r.fieldsPerRecord = n
+	}
+}
+
+//==============================================================================
+// Generator settings.
+//==============================================================================
+
+// VerifyRoundTrip sets whether each record written should be scanned again
+// with the same settings and compared with the original one while writing a
+// document. If the scanned record differs, writing fails with an error.
+//
+// This helps finding settings which generate documents that could not be read
+// back, but it is expensive, so it should only be used in tests.
+func VerifyRoundTrip(v bool) Setting {
+	return func(r *rule) {
+		r.verifyRoundTrip = v
+	}
+}
+
+// PadColumns sets whether fields should be padded with trailing spaces to align
+// the columns while writing a document, which makes the document easier to
+// read in a terminal. Since the widths of columns are computed from all the
+// records, only records written together with Generator.WriteAll are aligned.
+//
+// The last field of a record is never padded. The padding is omitted while
+// reading the document back, unless the OmitTrailingSpace setting is disabled.
+func PadColumns(v bool) Setting {
+	return func(r *rule) {
+		r.padColumns = v
+	}
+}
+
+// NullToken sets the token written for nil fields with Generator.WriteNullable.
+// The token is written as it is, except that it is wrapped with the prefix and
+// suffix if set, and a non-nil field equal to the token is quoted to be told
+// apart from it.
+//
+// By default the token is empty, so a nil field is written as nothing and an
+// empty field is written as "".
+func NullToken(token string) Setting {
+	return func(r *rule) {
+		r.nullToken = token
+	}
+}
+
+// EmptyFieldOutput sets the text written for empty fields while generating a
+// document, e.g. `""` or "-". The text is written as it is, without being
+// quoted or wrapped with the prefix and suffix. By default it is empty, and an
+// empty field is written as nothing, or quoted with the QuoteEmpty setting.
+func EmptyFieldOutput(text string) Setting {
+	return func(r *rule) {
+		r.emptyFieldOutput = text
+	}
+}
+
+// ForceQuote sets whether every field should be quoted while writing a
+// document. If not, a field is quoted only when needed, e.g. it contains a
+// quote, a line break or the separator. Quotes in fields are escaped by
+// doubling them, or with the escape rune if set with EscapeChar.
+func ForceQuote(v bool) Setting {
+	return func(r *rule) {
+		r.quoteAll = v
+	}
+}
+
+// QuoteEmpty sets whether empty fields should be quoted as "" while writing a
+// document, so that they can be told apart from absent values.
+func QuoteEmpty(v bool) Setting {
+	return func(r *rule) {
+		r.quoteEmpty = v
+	}
+}
+
+// WriteBOM sets whether the BOM (byte order mark) of the encoding should be
+// written at the start of a document, which helps Excel on Windows to read
+// UTF-8 documents with non-ASCII text. The BOM is written even if the document
+// has no records. Encodings other than UTF-8 and UTF-16 have no BOM, and the
+// BOM is written only once for encodings which write one of their own.
+func WriteBOM(v bool) Setting {
+	return func(r *rule) {
+		r.writeBOM = v
+	}
+}
+
+// LineTerminator sets the line end written between records while writing a
+// document, e.g. "\r\n" for Windows and Excel consumers.
+func LineTerminator(s string) Setting {
+	return func(r *rule) {
+		r.lineTerminator = s
+	}
+}
+
+// UseDetectedLineEnding sets the generator to use the line ending detected by s
+// while writing a document, so that the line ending of the scanned document is
+// preserved. If s has not detected a line ending, or the detected line ending
+// is LineEndingMixed, the setting is ignored.
+func UseDetectedLineEnding(s *Scanner) Setting {
+	return func(r *rule) {
+		switch lineEnding := s.DetectedLineEnding(); lineEnding {
+		case LineEndingLF, LineEndingCRLF, LineEndingCR:
+			r.lineTerminator = lineEnding
+		}
+	}
+}
+
 //==============================================================================
 // Unmarshaler and marshaler common settings.
 //==============================================================================
@@ -201,6 +844,17 @@ func HeaderSuffix(suffix rune) Setting {
 	}
 }
 
+// HeaderSeparator sets the separator rune of header names while unmarshaling
+// and marshaling a document.
+//
+// If a header separator is set, the Separator setting will be ignored while
+// reading and writing the header row, but will still be used for fields.
+func HeaderSeparator(separator rune) Setting {
+	return func(r *rule) {
+		r.headerSeparator = separator
+	}
+}
+
 // FieldPrefix sets the prefix rune of fields while unmarshaling and marshaling
 // a document.
 //
@@ -223,12 +877,30 @@ func FieldSuffix(suffix rune) Setting {
 	}
 }
 
+// TagKey sets the key of the struct field tags read while unmarshaling and
+// marshaling a document, which is "csv" by default. With different keys, the
+// same struct can be used for documents in different layouts, e.g.
+//
+//	type Order struct {
+//		ID    int    `csv:"id" partner:"order_no"`
+//		Notes string `csv:"notes" partner:"-"`
+//	}
+//
+//	csv.Marshal(orders, csv.TagKey("partner"))
+func TagKey(key string) Setting {
+	return func(r *rule) {
+		r.tagKey = key
+	}
+}
+
 //==============================================================================
 // Unmarshaler settings.
 //==============================================================================
 
-// Validator adds a new validator functions for validating a CSV value while
-// unmarshaling a document.
+// Validator adds a new validator function for validating a CSV value while
+// unmarshaling a document. To use a validator, add its name to the "csv"
+// struct field tag of the field. The validator is called with the value after
+// it is parsed into the type of the field, e.g. an int for an int field.
 func Validator(name string, validator func(interface{}) bool) Setting {
 	return func(r *rule) {
 		if r.validators == nil {
@@ -238,6 +910,106 @@ func Validator(name string, validator func(interface{}) bool) Setting {
 	}
 }
 
+// RawValidator adds a new validator function for validating a CSV value while
+// unmarshaling a document. Unlike Validator, the validator is called with the
+// field as a string before it is parsed.
+func RawValidator(name string, validator func(string) bool) Setting {
+	return func(r *rule) {
+		if r.rawValidators == nil {
+			r.rawValidators = make(map[string]func(string) bool)
+		}
+		r.rawValidators[name] = validator
+	}
+}
+
+// Header sets whether the first row of a document is a header row while
+// unmarshaling a document or scanning it with Scanner.ScanHeader and
+// Scanner.ScanAllWithHeader. If not, the first row will be treated as data,
+// and the header names should be given with the HeaderNames setting.
+//
+// Empty lines and comments omitted with the OmitEmptyLine and Comment settings
+// are skipped before the header row, so the header is the first real record.
+func Header(v bool) Setting {
+	return func(r *rule) {
+		r.header = v
+	}
+}
+
+// HeaderNames sets the header names used while unmarshaling a document or
+// scanning it with Scanner.ScanAllWithHeader. If set, these names are used
+// instead of the header row read from the document.
+//
+// The number of names must match the number of fields in every row.
+func HeaderNames(names []string) Setting {
+	return func(r *rule) {
+		r.headerNames = names
+	}
+}
+
+// ValidateHeader sets a function to validate the header while unmarshaling a
+// document or scanning it with Scanner.ScanAllWithHeader. fn is called with the
+// header before any data row is read, and if it returns an error, reading fails
+// with the error.
+func ValidateHeader(fn func(header []string) error) Setting {
+	return func(r *rule) {
+		r.validateHeader = fn
+	}
+}
+
+// An OverflowBehavior describes how a number out of the range of its type is
+// handled while unmarshaling a document.
+type OverflowBehavior int
+
+// Supported overflow behaviors.
+const (
+	// OverflowError returns an error for the number.
+	OverflowError OverflowBehavior = iota
+	// OverflowClamp sets the number to the minimum or maximum value of its
+	// type.
+	OverflowClamp
+	// OverflowWrap keeps the lowest bits of the number in two's complement, in
+	// the same way as an integer conversion in Go. Floating point numbers
+	// overflow to infinities.
+	OverflowWrap
+)
+
+// IntOverflow sets how numbers out of the range of their types are handled
+// while unmarshaling a document.
+func IntOverflow(v OverflowBehavior) Setting {
+	return func(r *rule) {
+		r.intOverflow = v
+	}
+}
+
+// ContinueOnError sets whether a data row which fails to be unmarshaled should
+// be skipped instead of failing the whole unmarshaling. The errors of skipped
+// rows can be got with UnmarshalWithResult.
+func ContinueOnError(v bool) Setting {
+	return func(r *rule) {
+		r.continueOnError = v
+	}
+}
+
+// HeaderCaseInsensitive sets whether header names are matched with the names
+// in struct field tags ignoring case while unmarshaling a document, e.g. a
+// column named "First_Name" is unmarshaled into a field tagged with
+// `csv:"first_name"`.
+func HeaderCaseInsensitive(v bool) Setting {
+	return func(r *rule) {
+		r.headerCaseInsensitive = v
+	}
+}
+
+// DisallowUnknownColumns sets whether a column in the header which matches no
+// struct field should cause an error while unmarshaling a document, which helps
+// to find typos in struct field tags and changes of the document. If not, such
+// columns are ignored.
+func DisallowUnknownColumns(v bool) Setting {
+	return func(r *rule) {
+		r.disallowUnknownColumns = v
+	}
+}
+
 //==============================================================================
 // Marshaler settings.
 //==============================================================================
@@ -249,12 +1021,91 @@ func WriteHeader(v bool) Setting {
 	}
 }
 
+// Translator adds a new translator function for marshaling a field with a type
+// which is not supported by Marshal. To use a translator, add its name to the
+// "csv" struct field tag of the field.
+func Translator(name string, translator func(interface{}) ([]byte, error)) Setting {
+	return func(r *rule) {
+		if r.translators == nil {
+			r.translators = make(map[string]func(interface{}) ([]byte, error))
+		}
+		r.translators[name] = translator
+	}
+}
+
+// VirtualColumn adds a column computed by fn while marshaling a document. fn is
+// called with each struct (or struct pointer) being marshaled, and returns the
+// value of the column.
+//
+// Virtual columns are written after the columns of struct fields, in the order
+// of being added, with name as the header name.
+func VirtualColumn(name string, fn func(v interface{}) (string, error)) Setting {
+	return func(r *rule) {
+		// Copy before appending to avoid sharing the underlying array with
+		// other rules.
+		var columns = make([]virtualColumn, len(r.virtualColumns), len(r.virtualColumns)+1)
+		copy(columns, r.virtualColumns)
+		r.virtualColumns = append(columns, virtualColumn{name: name, fn: fn})
+	}
+}
+
+// FloatFormat sets the format and precision of floating point numbers while
+// marshaling a document. format and prec have the same meanings as in
+// strconv.FormatFloat.
+func FloatFormat(format byte, prec int) Setting {
+	return func(r *rule) {
+		r.floatFormat = format
+		r.floatPrecision = prec
+	}
+}
+
+// A Rounding is a rounding mode of floating point numbers.
+type Rounding int
+
+// Supported rounding modes.
+const (
+	// RoundNearest rounds the exact binary value of a number to the nearest,
+	// in the same way as strconv.FormatFloat does.
+	RoundNearest Rounding = iota
+	// RoundHalfEven rounds the shortest decimal representation of a number to
+	// the nearest, and ties to even (banker's rounding).
+	RoundHalfEven
+	// RoundHalfUp rounds the shortest decimal representation of a number to
+	// the nearest, and ties away from zero.
+	RoundHalfUp
+	// RoundTruncate truncates the shortest decimal representation of a number
+	// towards zero.
+	RoundTruncate
+)
+
+// RoundingMode sets how floating point numbers are rounded to the precision
+// set with the FloatFormat setting while marshaling a document. It only works
+// with the 'f' format and a non-negative precision.
+func RoundingMode(mode Rounding) Setting {
+	return func(r *rule) {
+		r.rounding = mode
+	}
+}
+
+// TimeLocation sets the location which time.Time values are converted to
+// before being formatted while marshaling a document, so that the same instant
+// is always marshaled to the same value regardless of the local time zone.
+// While unmarshaling a document, values parsed with a "layout" tag option
+// without a time zone are in this location.
+func TimeLocation(loc *time.Location) Setting {
+	return func(r *rule) {
+		r.timeLocation = loc
+	}
+}
+
 // RFC4180 sets the parser and generator to work in the exact way as
 // described in RFC 4180.
 func RFC4180() Setting {
 	return func(r *rule) {
 		// Common rules.
-		r.separator = ','
+		r.setSeparator(',')
+		r.quote = '"'
+		r.escapeChar = noRune
 		r.prefix = noRune
 		r.suffix = noRune
 
@@ -267,6 +1118,9 @@ func RFC4180() Setting {
 		r.omitEmptyLine = false
 		r.comment = noRune
 
+		// Generator rules.
+		r.lineTerminator = "\r\n"
+
 		// Unmarshaler and marshaler common settings.
 		r.headerPrefix = noRune
 		r.headerSuffix = noRune
@@ -274,3 +1128,142 @@ func RFC4180() Setting {
 		r.fieldSuffix = noRune
 	}
 }
+
+// PythonExcel sets the parser and generator to work in the same way as the
+// "excel" dialect of Python's csv module, which uses ',' as the separator, '"'
+// as the quote (escaped by doubling it), and "\r\n" as the line end written
+// after every record including the last one. Fields are quoted only when
+// needed, and spaces are not omitted.
+//
+// Besides, prefix, suffix, single quotes and comments are disabled, and empty
+// fields are allowed.
+func PythonExcel() Setting {
+	return func(r *rule) {
+		pythonDialect(r)
+		r.lineTerminator = "\r\n"
+	}
+}
+
+// PythonExcelTab sets the parser and generator to work in the same way as the
+// "excel-tab" dialect of Python's csv module. It is the same as PythonExcel,
+// except that '\t' is used as the separator.
+func PythonExcelTab() Setting {
+	return func(r *rule) {
+		pythonDialect(r)
+		r.setSeparator('\t')
+		r.lineTerminator = "\r\n"
+	}
+}
+
+// PythonUnix sets the parser and generator to work in the same way as the
+// "unix" dialect of Python's csv module. It is the same as PythonExcel, except
+// that "\n" is used as the line end, and every field is quoted while writing a
+// document.
+func PythonUnix() Setting {
+	return func(r *rule) {
+		pythonDialect(r)
+		r.lineTerminator = "\n"
+		r.quoteAll = true
+	}
+}
+
+// pythonDialect applies the rules shared by all dialects of Python's csv
+// module.
+func pythonDialect(r *rule) {
+	// Common rules.
+	r.setSeparator(',')
+	r.quote = '"'
+	r.escapeChar = noRune
+	r.prefix = noRune
+	r.suffix = noRune
+
+	// Scanner rules.
+	r.allowSingleQuote = false
+	r.allowEmptyField = true
+	r.allowEndingLineBreakInLastRecord = true
+	r.omitLeadingSpace = false
+	r.omitTrailingSpace = false
+	r.comment = noRune
+
+	// Generator rules.
+	r.writeEndingLineBreak = true
+	r.quoteAll = false
+
+	// Unmarshaler and marshaler common settings.
+	r.headerPrefix = noRune
+	r.headerSuffix = noRune
+	r.fieldPrefix = noRune
+	r.fieldSuffix = noRune
+}
+
+// describe returns a human-readable summary of the common rules followed by
+// items, one per line.
+func (r *rule) describe(items ...string) string {
+	var compression = "none"
+	if r.compression == Gzip {
+		compression = "gzip"
+	}
+	var lines = append([]string{
+		"encoding: " + fmt.Sprint(r.encoding),
+		"separator: " + r.describeSeparator(),
+		"quote: " + describeRune(r.quote),
+		"prefix: " + describeRune(r.prefix),
+		"suffix: " + describeRune(r.suffix),
+		"escape char: " + describeRune(r.escapeChar),
+		"comment: " + describeRune(r.comment),
+		"compression: " + compression,
+		"escaped separator: " + strconv.FormatBool(r.escapedSeparator),
+	}, items...)
+	return strings.Join(lines, "\n")
+}
+
+// describeSeparator returns the separator in a human-readable form.
+func (r *rule) describeSeparator() string {
+	if r.separatorString != "" {
+		return strconv.Quote(r.separatorString)
+	}
+	return describeRune(r.separator)
+}
+
+// formatRule returns a rule with the rules of r which decide how fields are
+// separated, quoted and escaped, and the default values of the other rules,
+// e.g. for scanning back a document written with r.
+func (r *rule) formatRule() rule {
+	var format = defaultRule
+	format.separator = r.separator
+	format.separatorString = r.separatorString
+	format.quote = r.quote
+	format.escapeChar = r.escapeChar
+	format.prefix = r.prefix
+	format.suffix = r.suffix
+	format.escapedSeparator = r.escapedSeparator
+	format.allowSingleQuote = r.allowSingleQuote
+	format.omitLeadingSpace = r.omitLeadingSpace
+	format.omitTrailingSpace = r.omitTrailingSpace
+	format.allowCRLineEnd = r.allowCRLineEnd || r.lineTerminator == "\r"
+	format.comment = r.comment
+	format.trailingComment = r.trailingComment
+	return format
+}
+
+// setSeparator sets a separator of a single rune.
+func (r *rule) setSeparator(sep rune) {
+	r.separator = sep
+	r.separatorString = ""
+}
+
+// separatorText returns the separator as a string.
+func (r *rule) separatorText() string {
+	if r.separatorString != "" {
+		return r.separatorString
+	}
+	return string(r.separator)
+}
+
+// describeRune returns c quoted, or "none" if c is not set.
+func describeRune(c rune) string {
+	if c == noRune {
+		return "none"
+	}
+	return strconv.QuoteRune(c)
+}
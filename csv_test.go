@@ -0,0 +1,74 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/beta/csv"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestEncodingByName(t *testing.T) {
+	for _, name := range []string{"utf-8", "UTF8", "utf-16le", "windows-1252", "shift_jis", "Shift-JIS", "iso-8859-1"} {
+		enc, err := csv.EncodingByName(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if enc == nil {
+			t.Errorf("encoding %s is nil", name)
+		}
+	}
+
+	for name, expected := range map[string]interface{}{
+		"utf-8":        unicode.UTF8,
+		"windows-1252": charmap.Windows1252,
+		"shift_jis":    japanese.ShiftJIS,
+	} {
+		enc, err := csv.EncodingByName(name)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if enc != expected {
+			t.Errorf("encoding %s is wrong", name)
+		}
+	}
+
+	_, err := csv.EncodingByName("klingon")
+	if err == nil {
+		t.Errorf("unknown encoding is not reported")
+	}
+}
+
+func TestEncodingName(t *testing.T) {
+	s, err := csv.NewScanner([]byte("caf\xe9,b"), csv.EncodingName("windows-1252"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if rows[0][0] != "café" {
+		t.Errorf("document is not decoded correctly, get %q", rows[0][0])
+	}
+
+	_, err = csv.NewScanner([]byte("aaa"), csv.EncodingName("klingon"))
+	if err == nil {
+		t.Errorf("unknown encoding is not reported")
+	}
+	var g = csv.NewGenerator(csv.EncodingName("klingon"))
+	err = g.Write([]string{"aaa"})
+	if err == nil {
+		t.Errorf("unknown encoding is not reported")
+	}
+}
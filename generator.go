@@ -8,13 +8,28 @@ package csv
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // NewGenerator creates and returns a new generator with the given settings.
+// The document is kept in memory, and returned by Finish.
 func NewGenerator(settings ...Setting) *Generator {
+	var buf = bytes.NewBuffer(nil)
+	var g = NewGeneratorWriter(buf, settings...)
+	g.buf = buf
+	return g
+}
+
+// NewGeneratorWriter creates and returns a new generator writing to w with the
+// given settings. Records are buffered and written to w as the buffer fills,
+// or when Flush or Finish is called.
+func NewGeneratorWriter(w io.Writer, settings ...Setting) *Generator {
 	var g = &Generator{
 		rule: defaultRule,
 	}
@@ -22,29 +37,232 @@ func NewGenerator(settings ...Setting) *Generator {
 		setting(&g.rule)
 	}
 
-	g.buf = bytes.NewBuffer(nil)
-	g.w = bufio.NewWriter(g.rule.encoding.NewEncoder().Writer(g.buf))
+	if g.rule.compression == Gzip {
+		var gw = gzip.NewWriter(w)
+		g.compressor = gw
+		w = gw
+	}
+	var ew = g.rule.encoding.NewEncoder().Writer(w)
+	g.w = bufio.NewWriter(ew)
+	if g.rule.writeBOM {
+		// Encodings which cannot encode U+FEFF, i.e. those other than UTF-8 and
+		// UTF-16, have no BOM. Encoders which write a BOM of their own, e.g.
+		// UTF-16 with UseBOM, emit it for empty input, and are made to write it
+		// now instead of another one.
+		var encoder = g.rule.encoding.NewEncoder()
+		if own, _ := encoder.String(""); own != "" {
+			ew.Write(nil)
+		} else if _, err := encoder.String(bom); err == nil {
+			g.w.WriteString(bom)
+		}
+	}
 	return g
 }
 
 // A Generator generates a new CSV document.
 type Generator struct {
 	rule rule
-	buf  *bytes.Buffer
+	buf  *bytes.Buffer // Buffer of the document, nil if written to a writer.
 	w    *bufio.Writer
 
+	compressor *gzip.Writer // Compressing writer, nil if not compressed.
+
+	recordCount  int
+	fieldCount   int    // Number of fields written in the current record.
+	columnWidths []int  // Widths to pad fields to, nil if not padded.
+	numBuf       []byte // Buffer of formatted numbers.
+
 	finished bool
 }
 
+// Describe returns a human-readable summary of the settings used by g, one per
+// line, which helps to find out the settings in effect after applying presets
+// and overrides.
+func (g *Generator) Describe() string {
+	return g.rule.describe(
+		"line terminator: "+strconv.Quote(g.rule.lineTerminator),
+		"ending line break: "+strconv.FormatBool(g.rule.writeEndingLineBreak),
+		"quote all: "+strconv.FormatBool(g.rule.quoteAll),
+		"quote empty: "+strconv.FormatBool(g.rule.quoteEmpty),
+	)
+}
+
 // Write writes a record row to the end of the document.
 //
 // If Finish has been called, Write returns an error.
 func (g *Generator) Write(record []string) error {
-	if g.finished {
-		return fmt.Errorf("csv: Generator has been finished")
+	var err = g.checkWritable()
+	if err != nil {
+		return err
 	}
 
-	var err = g.writeRecord(record)
+	err = g.writeRecord(record)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// WriteField writes a field to the end of the current record. A separator is
+// written before the field if it is not the first one in the record. Call
+// EndRecord to finish the record.
+//
+// If Finish has been called, WriteField returns an error.
+func (g *Generator) WriteField(field string) error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeRecordField(field)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// WriteNullable writes a record row to the end of the document, where a nil
+// field is written as the token set with the NullToken setting.
+//
+// If Finish has been called, WriteNullable returns an error.
+func (g *Generator) WriteNullable(record []*string) error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeNullable(record)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// WriteQuoted writes a record row to the end of the document, where a field is
+// always quoted if the flag of the same index in quote is true. Other fields
+// are written in the same way as Write does, i.e. quoted only if necessary or
+// required by the ForceQuote and QuoteEmpty settings. It helps to keep the
+// original quoting of a document which is scanned and written again.
+//
+// If quote has a different length from record, or Finish has been called,
+// WriteQuoted returns an error.
+func (g *Generator) WriteQuoted(record []string, quote []bool) error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeQuoted(record, quote)
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// WriteInts writes a record of integers to the end of the document. The
+// integers are formatted in base 10 directly into the document, which is
+// faster than formatting them into strings and calling Write.
+//
+// If Finish has been called, WriteInts returns an error.
+func (g *Generator) WriteInts(record []int64) error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeNumbers(len(record), func(buf []byte, i int) []byte {
+		return strconv.AppendInt(buf, record[i], 10)
+	})
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// WriteFloats writes a record of floating point numbers to the end of the
+// document. The numbers are formatted with format and prec, which have the
+// same meanings as in strconv.FormatFloat, directly into the document, which
+// is faster than formatting them into strings and calling Write.
+//
+// If Finish has been called, WriteFloats returns an error.
+func (g *Generator) WriteFloats(record []float64, format byte, prec int) error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeNumbers(len(record), func(buf []byte, i int) []byte {
+		return strconv.AppendFloat(buf, record[i], format, prec, 64)
+	})
+	if err != nil {
+		return g.error(err)
+	}
+	return nil
+}
+
+// writeNumbers writes a record of n numbers, each of which is appended to a
+// buffer by appendNumber.
+func (g *Generator) writeNumbers(n int, appendNumber func(buf []byte, i int) []byte) error {
+	if g.fieldCount > 0 {
+		return fmt.Errorf("the current record is not ended")
+	}
+
+	var err error
+	for i := 0; i < n; i++ {
+		g.numBuf = appendNumber(g.numBuf[:0], i)
+		if g.rule.quoteAll || bytes.ContainsRune(g.numBuf, g.rule.separator) ||
+			(g.rule.separatorString != "" && bytes.ContainsAny(g.numBuf, g.rule.separatorString)) || (i == 0 && g.isCommentLike(string(g.numBuf))) ||
+			g.containsTrailingComment(string(g.numBuf)) {
+			// Quoted.
+			err = g.writeRecordField(string(g.numBuf))
+		} else {
+			err = g.writeNumberField(g.numBuf)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return g.endRecord()
+}
+
+// writeNumberField writes a formatted number as a field of the current record.
+// The number does not need to be quoted.
+func (g *Generator) writeNumberField(number []byte) error {
+	var err = g.beginField()
+	if err != nil {
+		return err
+	}
+
+	if g.rule.prefix != noRune {
+		_, err = g.w.WriteRune(g.rule.prefix)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = g.w.Write(number)
+	if err != nil {
+		return err
+	}
+	if g.rule.suffix != noRune {
+		_, err = g.w.WriteRune(g.rule.suffix)
+		if err != nil {
+			return err
+		}
+	}
+	g.fieldCount++
+	return nil
+}
+
+// EndRecord finishes the current record written with WriteField.
+//
+// If Finish has been called, EndRecord returns an error.
+func (g *Generator) EndRecord() error {
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	err = g.endRecord()
 	if err != nil {
 		return g.error(err)
 	}
@@ -55,11 +273,16 @@ func (g *Generator) Write(record []string) error {
 //
 // If Finish has been called, WriteAll returns an error.
 func (g *Generator) WriteAll(records [][]string) error {
-	if g.finished {
-		return fmt.Errorf("csv: Generator has been finished")
+	var err = g.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	if g.rule.padColumns {
+		g.columnWidths = g.measureColumns(records)
+		defer func() { g.columnWidths = nil }()
 	}
 
-	var err error
 	for _, record := range records {
 		err = g.writeRecord(record)
 		if err != nil {
@@ -69,89 +292,447 @@ func (g *Generator) WriteAll(records [][]string) error {
 	return nil
 }
 
+// measureColumns returns the max width of the written fields in each column of
+// records.
+func (g *Generator) measureColumns(records [][]string) []int {
+	var widths []int
+	for _, record := range records {
+		for i, field := range record {
+			var width = utf8.RuneCountInString(g.formatField(field, i == 0))
+			if i >= len(widths) {
+				widths = append(widths, width)
+			} else if width > widths[i] {
+				widths[i] = width
+			}
+		}
+	}
+	return widths
+}
+
+// checkWritable returns an error if the generator could not be written.
+func (g *Generator) checkWritable() error {
+	if g.rule.err != nil {
+		return g.rule.err
+	}
+	if g.finished {
+		return fmt.Errorf("csv: Generator has been finished")
+	}
+	return nil
+}
+
 func (g *Generator) error(err error) error {
 	return fmt.Errorf("csv: Generator failed: %s", err.Error())
 }
 
 func (g *Generator) writeRecord(record []string) error {
-	if g.w.Buffered() > 0 {
-		// Write a line end if the buffer is not empty.
-		_, err := g.w.WriteRune('\n')
+	if g.fieldCount > 0 {
+		return fmt.Errorf("the current record is not ended")
+	}
+	if g.rule.verifyRoundTrip {
+		var err = g.verifyRecord(record)
 		if err != nil {
 			return err
 		}
 	}
 
 	var err error
-	for i := 0; i < len(record); i++ {
-		var field = record[i]
-		err = g.writeField(field)
+	for i, field := range record {
+		err = g.writeRecordField(field)
 		if err != nil {
 			return err
 		}
-
-		if i < len(record)-1 {
-			err = g.writeSeparator()
+		if i < len(record)-1 && i < len(g.columnWidths) {
+			err = g.writePadding(g.columnWidths[i] - utf8.RuneCountInString(g.formatField(field, i == 0)))
 			if err != nil {
 				return err
 			}
 		}
 	}
-	return nil
+	return g.endRecord()
 }
 
-func (g *Generator) writeField(field string) error {
-	// Prefix.
-	if g.rule.prefix != noRune {
-		_, err := g.w.WriteRune(g.rule.prefix)
+func (g *Generator) writeQuoted(record []string, quote []bool) error {
+	if g.fieldCount > 0 {
+		return fmt.Errorf("the current record is not ended")
+	}
+	if len(quote) != len(record) {
+		return fmt.Errorf("%d quoting flags are given for %d fields", len(quote), len(record))
+	}
+
+	var err error
+	for i, field := range record {
+		err = g.beginField()
+		if err != nil {
+			return err
+		}
+		if quote[i] {
+			_, err = g.w.WriteString(g.quoteField(field))
+		} else {
+			err = g.writeField(field)
+		}
 		if err != nil {
 			return err
 		}
+		g.fieldCount++
 	}
+	return g.endRecord()
+}
 
-	if strings.ContainsAny(field, "\"\n") || strings.ContainsRune(field, g.rule.separator) {
-		var escaped = fmt.Sprintf(`"%s"`, strings.Replace(field, "\"", "\"\"", -1))
-		_, err := g.w.WriteString(escaped)
+func (g *Generator) writeNullable(record []*string) error {
+	if g.fieldCount > 0 {
+		return fmt.Errorf("the current record is not ended")
+	}
+
+	var err error
+	for _, field := range record {
+		err = g.beginField()
 		if err != nil {
 			return err
 		}
-	} else {
-		_, err := g.w.WriteString(field)
+		if field == nil {
+			_, err = g.w.WriteString(g.affixField(g.rule.nullToken))
+		} else if *field == g.rule.nullToken {
+			_, err = g.w.WriteString(g.quoteField(*field))
+		} else {
+			err = g.writeField(*field)
+		}
 		if err != nil {
 			return err
 		}
+		g.fieldCount++
 	}
+	return g.endRecord()
+}
 
-	// Suffix.
-	if g.rule.suffix != noRune {
-		_, err := g.w.WriteRune(g.rule.suffix)
+// verifyRecord writes record to a separate buffer, scans it back with the same
+// settings, and returns an error if the scanned record differs from record.
+func (g *Generator) verifyRecord(record []string) error {
+	var w, recordCount = g.w, g.recordCount
+	var buf = bytes.NewBuffer(nil)
+	g.w = bufio.NewWriter(buf)
+	g.recordCount = 0
+	g.rule.verifyRoundTrip = false
+	defer func() {
+		g.w, g.recordCount = w, recordCount
+		g.rule.verifyRoundTrip = true
+	}()
+
+	var err = g.writeRecord(record)
+	if err != nil {
+		return err
+	}
+	err = g.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	// The record is written without encoding and compression, and only the
+	// rules of the format are used to scan it.
+	s, err := NewScanner(buf.Bytes(), func(r *rule) {
+		*r = g.rule.formatRule()
+	})
+	if err != nil {
+		return fmt.Errorf("cannot scan record %q: %v", record, err)
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		return fmt.Errorf("cannot scan record %q: %v", record, err)
+	}
+
+	if len(record) == 0 || (len(record) == 1 && record[0] == "") {
+		// An empty record cannot be distinguished from a record with a single
+		// empty field.
+		if len(rows) == 0 || (len(rows) == 1 && len(rows[0]) == 1 && rows[0][0] == "") {
+			return nil
+		}
+	} else if len(rows) == 1 && len(rows[0]) == len(record) {
+		var equal = true
+		for i := range record {
+			if rows[0][i] != record[i] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			return nil
+		}
+	}
+	return fmt.Errorf("record %q is scanned back as %q", record, rows)
+}
+
+// beginRecord writes a line end before a new record if necessary.
+func (g *Generator) beginRecord() error {
+	if g.recordCount > 0 && !g.rule.writeEndingLineBreak {
+		// Write a line end if this is not the first record.
+		_, err := g.w.WriteString(g.rule.lineTerminator)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeRecordField writes a field of the current record, with a separator
+// before it if it is not the first field.
+func (g *Generator) writeRecordField(field string) error {
+	var err = g.beginField()
+	if err != nil {
+		return err
+	}
+
+	err = g.writeField(field)
+	if err != nil {
+		return err
+	}
+	g.fieldCount++
+	return nil
+}
+
+// beginField writes a line end before the first field of a record if
+// necessary, or a separator before other fields.
+func (g *Generator) beginField() error {
+	if g.fieldCount == 0 {
+		return g.beginRecord()
+	}
+	return g.writeSeparator()
+}
+
+// endRecord finishes the current record.
+func (g *Generator) endRecord() error {
+	if g.fieldCount == 0 {
+		// Empty record.
+		var err = g.beginRecord()
 		if err != nil {
 			return err
 		}
 	}
+
+	if g.rule.writeEndingLineBreak {
+		_, err := g.w.WriteString(g.rule.lineTerminator)
+		if err != nil {
+			return err
+		}
+	}
+	g.recordCount++
+	g.fieldCount = 0
 	return nil
 }
 
+func (g *Generator) writeField(field string) error {
+	_, err := g.w.WriteString(g.formatField(field, g.fieldCount == 0))
+	return err
+}
+
+// formatField returns field as it is written, with the prefix and suffix, and
+// quoted or escaped if necessary. first tells whether field is the first one in
+// its record.
+func (g *Generator) formatField(field string, first bool) string {
+	if field == "" && g.rule.emptyFieldOutput != "" {
+		return g.rule.emptyFieldOutput
+	}
+
+	var formatted string
+	var commentLike = (first && g.isCommentLike(field)) || g.containsTrailingComment(field)
+	if !commentLike && g.canEscapeSeparator(field) {
+		formatted = strings.Replace(field, string(g.rule.separator), "\\"+string(g.rule.separator), -1)
+	} else if commentLike || g.rule.quoteAll || (g.rule.quoteEmpty && field == "") || g.containsQuoteOrLineBreak(field) || g.containsSeparator(field) ||
+		(g.rule.escapedSeparator && strings.HasSuffix(field, "\\")) {
+		return g.quoteField(field)
+	} else {
+		formatted = field
+	}
+	return g.affixField(formatted)
+}
+
+// quoteField returns field quoted, with the prefix and suffix.
+func (g *Generator) quoteField(field string) string {
+	var quote = string(g.rule.quote)
+	if g.rule.escapeChar != noRune {
+		var escape = string(g.rule.escapeChar)
+		var replacer = strings.NewReplacer(escape, escape+escape, quote, escape+quote)
+		return g.affixField(quote + replacer.Replace(field) + quote)
+	}
+	return g.affixField(quote + strings.Replace(field, quote, quote+quote, -1) + quote)
+}
+
+// containsQuoteOrLineBreak reports whether field contains the quote or a line
+// break, which makes it necessary to quote the field.
+func (g *Generator) containsQuoteOrLineBreak(field string) bool {
+	return strings.ContainsRune(field, g.rule.quote) || strings.ContainsAny(field, "\r\n")
+}
+
+// affixField returns field with the prefix and suffix.
+func (g *Generator) affixField(field string) string {
+	if g.rule.prefix != noRune {
+		field = string(g.rule.prefix) + field
+	}
+	if g.rule.suffix != noRune {
+		field += string(g.rule.suffix)
+	}
+	return field
+}
+
+// isCommentLike reports whether field would make a line be read as a comment
+// if it is written at the start of the line without being quoted.
+func (g *Generator) isCommentLike(field string) bool {
+	return g.rule.comment != noRune && g.rule.prefix == noRune && strings.HasPrefix(field, string(g.rule.comment))
+}
+
+// containsTrailingComment reports whether field contains the comment rune,
+// which starts a comment in an unquoted field with the TrailingComment setting.
+func (g *Generator) containsTrailingComment(field string) bool {
+	return g.rule.trailingComment && g.rule.comment != noRune && strings.ContainsRune(field, g.rule.comment)
+}
+
+// writePadding writes n spaces.
+func (g *Generator) writePadding(n int) error {
+	if n <= 0 {
+		return nil
+	}
+	_, err := g.w.WriteString(strings.Repeat(" ", n))
+	return err
+}
+
+// containsSeparator reports whether field contains the separator, or any rune
+// of a separator set with SeparatorString.
+func (g *Generator) containsSeparator(field string) bool {
+	if g.rule.separatorString != "" {
+		return strings.ContainsAny(field, g.rule.separatorString)
+	}
+	return strings.ContainsRune(field, g.rule.separator)
+}
+
+// canEscapeSeparator reports whether the separators in field could be escaped
+// with backslashes instead of quoting the field.
+func (g *Generator) canEscapeSeparator(field string) bool {
+	if !g.rule.escapedSeparator || g.rule.quoteAll || g.rule.separatorString != "" || !strings.ContainsRune(field, g.rule.separator) {
+		return false
+	}
+	if g.containsQuoteOrLineBreak(field) {
+		return false
+	}
+	// A backslash at the end of the field, or one already before a separator,
+	// would be read as an escape.
+	return !strings.HasSuffix(field, "\\") && !strings.Contains(field, "\\"+string(g.rule.separator))
+}
+
 func (g *Generator) writeSeparator() error {
-	_, err := g.w.WriteRune(g.rule.separator)
+	var err error
+	if g.rule.separatorString != "" {
+		_, err = g.w.WriteString(g.rule.separatorString)
+	} else {
+		_, err = g.w.WriteRune(g.rule.separator)
+	}
 	return err
 }
 
+// Flush writes the buffered records to the underlying writer. If the document
+// is compressed, the compressed data written so far is flushed as well.
+func (g *Generator) Flush() error {
+	if g.rule.err != nil {
+		return g.rule.err
+	}
+
+	var err = g.w.Flush()
+	if err != nil {
+		return g.error(err)
+	}
+	if g.compressor != nil {
+		err = g.compressor.Flush()
+		if err != nil {
+			return g.error(err)
+		}
+	}
+	return nil
+}
+
 // Finish finishes writing to the generator and returns data of the document.
 //
+// If a record written with WriteField is not ended, Finish ends it.
+//
+// If the generator is created with NewGeneratorWriter, Finish flushes the rest
+// of the document to the writer and returns nil data.
+//
 // After calling Finish, the generator can no longer be written. Any call to
 // Write and WriteAll will return an error.
 func (g *Generator) Finish() ([]byte, error) {
+	if g.rule.err != nil {
+		return nil, g.rule.err
+	}
 	g.finished = true
 
+	if g.fieldCount > 0 {
+		var err = g.endRecord()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	var err = g.w.Flush()
 	if err != nil {
 		return nil, err
 	}
+	if g.compressor != nil {
+		// Closing flushes the remaining compressed data and writes the footer.
+		err = g.compressor.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	if g.buf == nil {
+		// Written to a writer.
+		return nil, nil
+	}
 	data, err := ioutil.ReadAll(g.buf)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
+
+// FinishWith works in the same way as Finish, and replaces the line ends
+// between records with lineEnding, e.g. "\r\n", so that the line end can be
+// chosen after all the records are written. Line breaks in quoted fields are
+// kept as they are.
+//
+// FinishWith can only be used with a generator created with NewGenerator,
+// without compression, and with "\n" as the line terminator.
+func (g *Generator) FinishWith(lineEnding string) ([]byte, error) {
+	if g.buf == nil || g.compressor != nil || g.rule.lineTerminator != "\n" {
+		return nil, g.error(fmt.Errorf("line ends cannot be replaced in a document written to a writer, compressed, or written with a line terminator other than \\n"))
+	}
+
+	data, err := g.Finish()
+	if err != nil || lineEnding == "\n" {
+		return data, err
+	}
+
+	text, err := g.rule.encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return nil, g.error(err)
+	}
+	var replaced = make([]byte, 0, len(text))
+	var quoted, escaped = false, false
+	for _, c := range string(text) {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && g.rule.escapeChar != noRune && c == g.rule.escapeChar:
+			escaped = true
+		case c == g.rule.quote:
+			// An escaped quote toggles the state twice.
+			quoted = !quoted
+		case c == '\n' && !quoted:
+			replaced = append(replaced, lineEnding...)
+			continue
+		}
+		replaced = append(replaced, string(c)...)
+	}
+
+	data, err = g.rule.encoding.NewEncoder().Bytes(replaced)
+	if err != nil {
+		return nil, g.error(err)
+	}
+	return data, nil
+}
@@ -6,9 +6,14 @@
 package csv_test
 
 import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/beta/csv"
+	"golang.org/x/text/encoding/unicode"
 )
 
 var records = [][]string{{"aaa", "bbb", "ccc"}, {"aaa", "b\nbb", "cc,c"}}
@@ -28,7 +33,7 @@ func TestGenerator(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	t.Logf(string(data))
+	t.Log(string(data))
 }
 
 func TestGeneratorWriteAll(t *testing.T) {
@@ -43,7 +48,7 @@ func TestGeneratorWriteAll(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	t.Logf(string(data))
+	t.Log(string(data))
 }
 
 func TestGeneratorWithCustomSeparator(t *testing.T) {
@@ -58,7 +63,122 @@ func TestGeneratorWithCustomSeparator(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	t.Logf(string(data))
+	t.Log(string(data))
+}
+
+func TestGeneratorWithSeparatorString(t *testing.T) {
+	var original = [][]string{
+		{"a", "b", "c"},
+		{"a|", "|b", "x||y"},
+		{"", "1,2", "end"},
+	}
+	var g = csv.NewGenerator(csv.SeparatorString("||"))
+	var err = g.WriteAll(original)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "a||b||c\n\"a|\"||\"|b\"||\"x||y\"\n||1,2||end"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	s, err := csv.NewScanner(data, csv.SeparatorString("||"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, original) {
+		t.Errorf("rows are not read back, expect %q, get %q", original, rows)
+		return
+	}
+
+	// A part of the separator in an unquoted field is read as it is.
+	s, err = csv.NewScanner([]byte("a|b||c"), csv.SeparatorString("||"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(row, []string{"a|b", "c"}) {
+		t.Errorf("fields are wrong, get %q", row)
+		return
+	}
+
+	_, err = csv.NewScanner([]byte("a,b"), csv.SeparatorString(""))
+	if err == nil {
+		t.Errorf("empty separator is not reported")
+	}
+}
+
+func TestGeneratorWithQuote(t *testing.T) {
+	var original = [][]string{
+		{"name", "note"},
+		{"a`b", `say "hi"`},
+		{"x,y", "`"},
+	}
+	var g = csv.NewGenerator(csv.Quote('`'))
+	var err = g.WriteAll(original)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "name,note\n`a``b`,say \"hi\"\n`x,y`,````"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	s, err := csv.NewScanner(data, csv.Quote('`'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, original) {
+		t.Errorf("rows are not read back, expect %q, get %q", original, rows)
+		return
+	}
+
+	// Single quotes are still allowed along with the quote.
+	s, err = csv.NewScanner([]byte("`a,b`,'c,d'"), csv.Quote('`'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(row, []string{"a,b", "c,d"}) {
+		t.Errorf("row is wrong, get %q", row)
+		return
+	}
 }
 
 func TestGeneratorWithPrefixSuffix(t *testing.T) {
@@ -73,5 +193,734 @@ func TestGeneratorWithPrefixSuffix(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	t.Logf(string(data))
+	t.Log(string(data))
+}
+
+func TestGeneratorWithGzip(t *testing.T) {
+	var g = csv.NewGenerator(csv.Compression(csv.Gzip))
+	var err = g.WriteAll(records)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	s, err := csv.NewScanner(data, csv.Compression(csv.Gzip))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != len(records) || rows[1][1] != records[1][1] || rows[1][2] != records[1][2] {
+		t.Errorf("records are not round-tripped through gzip")
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestGeneratorWithPythonDialects(t *testing.T) {
+	// Expected outputs are generated with Python's csv.writer.
+	var cases = []struct {
+		name     string
+		setting  csv.Setting
+		expected string
+	}{
+		{"excel", csv.PythonExcel(), "aaa,bbb,ccc\r\naaa,\"b\nbb\",\"cc,c\"\r\n"},
+		{"excel-tab", csv.PythonExcelTab(), "aaa\tbbb\tccc\r\naaa\t\"b\nbb\"\tcc,c\r\n"},
+		{"unix", csv.PythonUnix(), "\"aaa\",\"bbb\",\"ccc\"\n\"aaa\",\"b\nbb\",\"cc,c\"\n"},
+	}
+	for _, c := range cases {
+		var g = csv.NewGenerator(c.setting)
+		var err = g.WriteAll(records)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if string(data) != c.expected {
+			t.Errorf("output of dialect %s is wrong, expect %q, get %q", c.name, c.expected, string(data))
+		}
+	}
+}
+
+func TestGeneratorWriteField(t *testing.T) {
+	var g = csv.NewGenerator()
+	var err error
+	for _, record := range records {
+		for _, field := range record {
+			err = g.WriteField(field)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		err = g.EndRecord()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var expected = "aaa,bbb,ccc\naaa,\"b\nbb\",\"cc,c\""
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+}
+
+func TestGeneratorWithVerifyRoundTrip(t *testing.T) {
+	var g = csv.NewGenerator(csv.VerifyRoundTrip(true))
+	var err = g.WriteAll(records)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	// Single quotes are allowed while scanning, but the generator does not
+	// quote fields containing them, so this record could not be read back.
+	err = g.Write([]string{"aaa", "'bbb'"})
+	if err == nil {
+		t.Errorf("round trip mismatch is not detected")
+		return
+	}
+	t.Log(err)
+
+	// Rules only used while reading a whole document do not affect the check.
+	var progressed bool
+	g = csv.NewGenerator(csv.VerifyRoundTrip(true), csv.SkipRows(1), csv.FieldsPerRecord(3),
+		csv.Progress(1, func(int) { progressed = true }))
+	err = g.Write([]string{"a", "b"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if progressed {
+		t.Error("progress is reported while verifying a record")
+		return
+	}
+}
+
+func TestGeneratorUseDetectedLineEnding(t *testing.T) {
+	s, err := csv.NewScanner([]byte("aaa,bbb\r\nccc,ddd\r\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var g = csv.NewGenerator(csv.UseDetectedLineEnding(s))
+	err = g.WriteAll(records)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = "aaa,bbb,ccc\r\naaa,\"b\nbb\",\"cc,c\""
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+	}
+}
+
+func TestGeneratorWithEscapedSeparator(t *testing.T) {
+	var records = [][]string{{"a,a", "bbb", `c\`}, {"a\na", `b\,b`, "c,c,c"}}
+	var g = csv.NewGenerator(csv.EscapedSeparator(true))
+	var err = g.WriteAll(records)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = "a\\,a,bbb,\"c\\\"\n\"a\na\",\"b\\,b\",c\\,c\\,c"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	s, err := csv.NewScanner(data, csv.EscapedSeparator(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := range records {
+		if strings.Join(rows[i], "|") != strings.Join(records[i], "|") {
+			t.Errorf("record %d is not round-tripped, expect %q, get %q", i, records[i], rows[i])
+		}
+	}
+}
+
+func TestGeneratorWithPadColumns(t *testing.T) {
+	var g = csv.NewGenerator(csv.PadColumns(true))
+	var err = g.WriteAll([][]string{{"id", "name", "note"}, {"1", "Zoë", "x,y"}, {"100", "Al", "z"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "id ,name,note\n1  ,Zoë ,\"x,y\"\n100,Al  ,z"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	s, err := csv.NewScanner(data)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 3 || rows[1][1] != "Zoë" || rows[2][0] != "100" || rows[1][2] != "x,y" {
+		t.Errorf("padded output is not read back, get %q", rows)
+	}
+}
+
+func TestGeneratorWriteNumbers(t *testing.T) {
+	var g = csv.NewGenerator(csv.Prefix('['), csv.Suffix(']'))
+	var err = g.WriteInts([]int64{1, -20, 300})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = g.WriteFloats([]float64{1.5, -0.25, 1e21}, 'g', -1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "[1],[-20],[300]\n[1.5],[-0.25],[1e+21]"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	// Numbers containing the separator are quoted.
+	g = csv.NewGenerator(csv.Separator('.'))
+	err = g.WriteFloats([]float64{1.5, 2}, 'f', 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != `"1.5"."2.0"` {
+		t.Errorf("output is wrong, get %q", string(data))
+	}
+}
+
+func TestGeneratorWriteNumbersWithTrailingComment(t *testing.T) {
+	for _, comment := range []rune{'-', '.', 'e', '+'} {
+		var settings = []csv.Setting{csv.Comment(comment), csv.TrailingComment(true)}
+		var g = csv.NewGenerator(settings...)
+		var err = g.WriteInts([]int64{1, -5})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		err = g.WriteFloats([]float64{1.5, 1e21}, 'g', -1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		s, err := csv.NewScanner(data, settings...)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows, err := s.ScanAll()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var expected = [][]string{{"1", "-5"}, {"1.5", "1e+21"}}
+		if !reflect.DeepEqual(rows, expected) {
+			t.Errorf("numbers are not round-tripped with comment %q, expect %q, get %q from %q", comment, expected, rows, data)
+		}
+	}
+}
+
+func TestGeneratorWriteQuoted(t *testing.T) {
+	const original = `"id",name,"note"
+"1",Alice,"a, b"
+2,"Bob",`
+	var quote = [][]bool{
+		{true, false, true},
+		{true, false, true},
+		{false, true, false},
+	}
+	s, err := csv.NewScanner([]byte(original))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var g = csv.NewGenerator()
+	for i, row := range rows {
+		err = g.WriteQuoted(row, quote[i])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != original {
+		t.Errorf("quoting is not kept, expect %q, get %q", original, string(data))
+		return
+	}
+
+	// Fields which must be quoted are quoted without the flags.
+	g = csv.NewGenerator()
+	err = g.WriteQuoted([]string{"a,b", "c"}, []bool{false, false})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != `"a,b",c` {
+		t.Errorf("output is wrong, get %q", string(data))
+		return
+	}
+
+	g = csv.NewGenerator()
+	err = g.WriteQuoted([]string{"a", "b"}, []bool{true})
+	if err == nil {
+		t.Errorf("mismatched quoting flags are not reported")
+	}
+}
+
+func TestGeneratorWithEmptyFieldOutput(t *testing.T) {
+	var cases = []struct {
+		output   string
+		expected string
+	}{
+		{"", "a,,c\n,b,"},
+		{`""`, `a,"",c` + "\n" + `"",b,""`},
+		{"-", "a,-,c\n-,b,-"},
+	}
+	for _, c := range cases {
+		var g = csv.NewGenerator(csv.EmptyFieldOutput(c.output))
+		var err = g.WriteAll([][]string{{"a", "", "c"}, {"", "b", ""}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if string(data) != c.expected {
+			t.Errorf("output with %q for empty fields is wrong, expect %q, get %q", c.output, c.expected, string(data))
+			return
+		}
+	}
+}
+
+func TestGeneratorWriteNullable(t *testing.T) {
+	var name, empty, null = "Alice", "", "NULL"
+	var g = csv.NewGenerator(csv.NullToken("NULL"))
+	var err = g.WriteNullable([]*string{&name, nil, &empty, &null})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = `Alice,NULL,,"NULL"`
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	// With the default empty token, empty fields are quoted.
+	g = csv.NewGenerator()
+	err = g.WriteNullable([]*string{nil, &empty, &name})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != `,"",Alice` {
+		t.Errorf("output is wrong, get %q", string(data))
+		return
+	}
+
+	// The token is wrapped with the prefix and suffix.
+	var settings = []csv.Setting{csv.Prefix('('), csv.Suffix(')'), csv.NullToken("NULL")}
+	g = csv.NewGenerator(settings...)
+	err = g.WriteNullable([]*string{nil, &name, &null})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != `(NULL),(Alice),("NULL")` {
+		t.Errorf("output is wrong, get %q", string(data))
+		return
+	}
+	s, err := csv.NewScanner(data, settings...)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"NULL", "Alice", "NULL"}}) {
+		t.Errorf("scanned records are wrong, get %q", rows)
+	}
+}
+
+func TestNewGeneratorWriter(t *testing.T) {
+	var buf = bytes.NewBuffer(nil)
+	var g = csv.NewGeneratorWriter(buf)
+	var err = g.Write([]string{"aaa", "b,bb"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = g.Flush()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if buf.String() != `aaa,"b,bb"` {
+		t.Errorf("flushed output is wrong, get %q", buf.String())
+		return
+	}
+
+	err = g.Write([]string{"ccc", "ddd"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if data != nil {
+		t.Errorf("expect nil data, get %q", data)
+		return
+	}
+	const expected = "aaa,\"b,bb\"\nccc,ddd"
+	if buf.String() != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, buf.String())
+	}
+}
+
+func TestGeneratorWithLineTerminator(t *testing.T) {
+	var cases = []struct {
+		settings []csv.Setting
+		expected string
+	}{
+		{nil, "aaa,bbb\nccc,ddd"},
+		{[]csv.Setting{csv.LineTerminator("\r\n")}, "aaa,bbb\r\nccc,ddd"},
+		{[]csv.Setting{csv.RFC4180()}, "aaa,bbb\r\nccc,ddd"},
+	}
+	for _, c := range cases {
+		var g = csv.NewGenerator(c.settings...)
+		var err = g.WriteAll([][]string{{"aaa", "bbb"}, {"ccc", "ddd"}})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(data, []byte(c.expected)) {
+			t.Errorf("output is wrong, expect %q, get %q", c.expected, data)
+		}
+	}
+}
+
+func TestGeneratorWithForceQuote(t *testing.T) {
+	var cases = []struct {
+		settings []csv.Setting
+		expected string
+	}{
+		{nil, `aaa,"b""bb",,"c,cc"`},
+		{[]csv.Setting{csv.ForceQuote(true)}, `"aaa","b""bb","","c,cc"`},
+		{[]csv.Setting{csv.QuoteEmpty(true)}, `aaa,"b""bb","","c,cc"`},
+	}
+	for _, c := range cases {
+		var g = csv.NewGenerator(c.settings...)
+		var err = g.Write([]string{"aaa", `b"bb`, "", "c,cc"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if string(data) != c.expected {
+			t.Errorf("output is wrong, expect %q, get %q", c.expected, data)
+		}
+	}
+}
+
+func TestGeneratorFinishWith(t *testing.T) {
+	for _, lineEnding := range []string{"\n", "\r\n"} {
+		var g = csv.NewGenerator()
+		var err = g.WriteAll(records)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err := g.FinishWith(lineEnding)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var expected = "aaa,bbb,ccc" + lineEnding + "aaa,\"b\nbb\",\"cc,c\""
+		if string(data) != expected {
+			t.Errorf("output is wrong, expect %q, get %q", expected, data)
+			return
+		}
+	}
+
+	// A NUL rune in a quoted field is not an escape.
+	var g = csv.NewGenerator()
+	var err = g.WriteAll([][]string{{"a\x00\"", "b"}, {"c", "d"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.FinishWith("\r\n")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "\"a\x00\"\"\",b\r\nc,d"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, data)
+		return
+	}
+
+	g = csv.NewGenerator(csv.Compression(csv.Gzip))
+	_, err = g.FinishWith("\r\n")
+	if err == nil {
+		t.Errorf("replacing line ends in a compressed document is not reported")
+	}
+}
+
+func TestGeneratorWriteBOM(t *testing.T) {
+	var g = csv.NewGenerator(csv.WriteBOM(true))
+	var err = g.Write([]string{"café", "naïve"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte("\xEF\xBB\xBFcafé,naïve")) {
+		t.Errorf("output is wrong, get %q", data)
+		return
+	}
+
+	// The BOM is written without records.
+	g = csv.NewGenerator(csv.WriteBOM(true))
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !bytes.Equal(data, []byte("\xEF\xBB\xBF")) {
+		t.Errorf("output is wrong, get %q", data)
+		return
+	}
+
+	// UTF-16 with UseBOM writes its own BOM, which is not repeated.
+	var utf16 = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	for _, records := range [][][]string{{{"a", "b"}}, nil} {
+		g = csv.NewGenerator(csv.WriteBOM(true), csv.Encoding(utf16))
+		err = g.WriteAll(records)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, err = g.Finish()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var expected = "\xFF\xFE"
+		if records != nil {
+			expected += "a\x00,\x00b\x00"
+		}
+		if string(data) != expected {
+			t.Errorf("output is wrong, expect %q, get %q", expected, data)
+			return
+		}
+	}
+
+	// Windows-1252 has no BOM.
+	g = csv.NewGenerator(csv.WriteBOM(true), csv.EncodingName("windows-1252"))
+	data, err = g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(data) != 0 {
+		t.Errorf("output is wrong, get %q", data)
+	}
+}
+
+func TestGeneratorDescribe(t *testing.T) {
+	var g = csv.NewGenerator(csv.Separator('\t'), csv.PythonExcel())
+	var description = g.Describe()
+	if !strings.Contains(description, "separator: ','") || !strings.Contains(description, `quote: '"'`) ||
+		!strings.Contains(description, `line terminator: "\r\n"`) {
+		t.Errorf("description is wrong, get %q", description)
+		return
+	}
+	t.Log(description)
+
+	description = csv.NewGenerator(csv.Quote('`')).Describe()
+	if !strings.Contains(description, "quote: '`'") {
+		t.Errorf("description is wrong, get %q", description)
+		return
+	}
+}
+
+var numbers = []int64{1, 22, 333, 4444, 55555, 666666, 7777777, 88888888}
+
+func BenchmarkGeneratorWrite(b *testing.B) {
+	var g = csv.NewGenerator()
+	for i := 0; i < b.N; i++ {
+		var record = make([]string, len(numbers))
+		for j, n := range numbers {
+			record[j] = strconv.FormatInt(n, 10)
+		}
+		g.Write(record)
+	}
+}
+
+func BenchmarkGeneratorWriteInts(b *testing.B) {
+	var g = csv.NewGenerator()
+	for i := 0; i < b.N; i++ {
+		g.WriteInts(numbers)
+	}
+}
+
+func TestGeneratorWithComment(t *testing.T) {
+	var records = [][]string{{"#note", "aaa"}, {"bbb", "#ccc"}}
+	var g = csv.NewGenerator(csv.Comment('#'))
+	var err = g.WriteAll(records)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "\"#note\",aaa\nbbb,#ccc"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	s, err := csv.NewScanner(data, csv.Comment('#'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 2 || rows[0][0] != "#note" {
+		t.Errorf("record starting with the comment rune is lost, get %q", rows)
+	}
 }
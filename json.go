@@ -0,0 +1,89 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ToJSONLines converts the CSV document read from src to JSON lines (also known
+// as NDJSON) with the given settings, and writes them to dst. The document is
+// read and converted row by row, so it does not have to fit in memory.
+//
+// Each data row is converted to a JSON object in a line, whose keys are the
+// header names, and values are the fields as strings. Keys are written in the
+// order of the header. If the number of fields in a row differs from the
+// number of header names, an error will be returned, unless the
+// NormalizeToHeader setting is enabled.
+func ToJSONLines(src io.Reader, dst io.Writer, settings ...Setting) error {
+	s, err := NewScannerReader(src, settings...)
+	if err != nil {
+		return err
+	}
+	header, err := s.scanValidHeader()
+	if err != nil {
+		return err
+	}
+
+	var w = bufio.NewWriter(dst)
+	var keys = make([][]byte, len(header))
+	for i, name := range header {
+		keys[i], err = json.Marshal(name)
+		if err != nil {
+			return fmt.Errorf("csv: cannot convert header name %q: %v", name, err)
+		}
+	}
+	// Rows are converted and written one by one, so the document is never kept
+	// in memory as a whole, and each line is written to dst once converted.
+	for i := 1; ; i++ {
+		row, err := s.scanDataRow(header, i)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			return fmt.Errorf("csv: no header found, use the HeaderNames setting to give one")
+		}
+		if len(row) != len(header) {
+			return fmt.Errorf("csv: data row %d has %d fields but the header has %d columns", i, len(row), len(header))
+		}
+		err = writeJSONObject(w, keys, row)
+		if err != nil {
+			return fmt.Errorf("csv: cannot convert data row %d: %v", i, err)
+		}
+		err = w.Flush()
+		if err != nil {
+			return fmt.Errorf("csv: cannot write JSON lines: %v", err)
+		}
+	}
+	return nil
+}
+
+// writeJSONObject writes a JSON object with the encoded keys and the values of
+// row, followed by a line break.
+func writeJSONObject(w *bufio.Writer, keys [][]byte, row []string) error {
+	w.WriteByte('{')
+	for i, field := range row {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		value, err := json.Marshal(field)
+		if err != nil {
+			return err
+		}
+		w.Write(keys[i])
+		w.WriteByte(':')
+		w.Write(value)
+	}
+	w.WriteByte('}')
+	_, err := w.WriteString("\n")
+	return err
+}
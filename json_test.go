@@ -0,0 +1,80 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beta/csv"
+)
+
+func TestToJSONLines(t *testing.T) {
+	const data = `name,quote,age
+John,"He said ""hi""",25
+Mary,"a
+b",23`
+	var buf bytes.Buffer
+	var err = csv.ToJSONLines(strings.NewReader(data), &buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = `{"name":"John","quote":"He said \"hi\"","age":"25"}
+{"name":"Mary","quote":"a\nb","age":"23"}
+`
+	if buf.String() != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, buf.String())
+		return
+	}
+	t.Log(buf.String())
+}
+
+// lineWriter sends each written line to lines.
+type lineWriter struct {
+	lines chan string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.lines <- string(p)
+	return len(p), nil
+}
+
+func TestToJSONLinesStreaming(t *testing.T) {
+	var r, w = io.Pipe()
+	var dst = &lineWriter{lines: make(chan string, 10)}
+	var done = make(chan error, 1)
+	go func() {
+		done <- csv.ToJSONLines(r, dst)
+	}()
+
+	// The first row is converted before the end of the document is written. A
+	// row is returned once the line after it is read.
+	io.WriteString(w, "name,age\nJohn,25\nMary,23\n")
+	select {
+	case line := <-dst.lines:
+		if line != `{"name":"John","age":"25"}`+"\n" {
+			t.Errorf("line is wrong, get %q", line)
+			return
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("the first row is not converted before the end of the document")
+		return
+	}
+	w.Close()
+
+	var err = <-done
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if line := <-dst.lines; line != `{"name":"Mary","age":"23"}`+"\n" {
+		t.Errorf("line is wrong, get %q", line)
+	}
+}
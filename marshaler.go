@@ -5,37 +5,65 @@
 
 package csv
 
+import (
+	"encoding"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // Marshal generates a CSV document from v with the given settings.
 //
 // v should be an array/slice of struct or struct pointers. In these structs,
-// each exported field will be marshaled as a CSV field, with the field name as
-// the column header. This can be customized with a "csv" struct field tag,
-// which gives the name of the field. Use "-" to omit a field from being
-// marshaled. Use "-," to set the header name to "-".
+// each exported field with a "csv" struct field tag will be marshaled as a CSV
+// field, with the name given in the tag as the column header, in the same way
+// as Unmarshal reads them. Columns are written in the order of the fields
+// declared in the struct. Use "-" to omit a field from being marshaled. Use
+// "-," to set the header name to "-". A header name containing commas can be
+// quoted with single quotes, with single quotes in it doubled. If no field is
+// tagged, an error will be returned. Fields with the "overflow" option are not
+// marshaled.
 //
 // Below are some example of using the "csv" struct field tag.
 //
-//     // Field will be marshaled with "myName" as its header name.
-//     Field int `csv:"myName"`
+//	// Field will be marshaled with "myName" as its header name.
+//	Field int `csv:"myName"`
+//
+//	// Field is ignored.
+//	Field int `csv:"-"`
 //
-//     // Field is ignored.
-//     Field int `csv:"-"`
+//	// Field will be marshaled with "-" as its header name.
+//	Field int `csv:"-,"`
 //
-//     // Field will be marshaled with "-" as its header name.
-//     Field int `csv:"-,"`
+//	// Field will be marshaled with "Revenue, USD" as its header name.
+//	Field int `csv:"'Revenue, USD'"`
 //
 // Marshal supports the following types:
 //
 // A boolean value will be marshaled to "true" or "false" based on its value.
 //
 // A floating point, integer or number value will be marshaled to the string
-// representation of its value.
+// representation of its value. Floating point numbers are formatted with the
+// FloatFormat and RoundingMode settings.
 //
 // A string value will be marshaled to the value of itself.
 //
+// A time.Time value will be converted to the location set with the
+// TimeLocation setting, and marshaled in the RFC 3339 format, or with the
+// layout given with a "layout" option in the tag, e.g.
+//
+//	CreatedAt time.Time `csv:"created_at,layout=2006-01-02"`
+//
 // Any type implementing encoding.TextMarshaler will be marshaled to the value
 // returned by MarshalText.
 //
+// A nil pointer will be marshaled to an empty field.
+//
 // If Marshal encounters a field with an unsupported type, an
 // UnsupportedTypeError will be returned.
 //
@@ -44,33 +72,546 @@ package csv
 // the Translator setting to register one or more translators before marshaling.
 // For example:
 //
-//     func TranslateIntSlice(slice interface{}) ([]byte, error) {
-//         ...
-//     }
+//	func TranslateIntSlice(slice interface{}) ([]byte, error) {
+//		...
+//	}
 //
-//     csv.Marshal(..., csv.Translator("intSlice", TranslateIntSlice))
+//	csv.Marshal(..., csv.Translator("intSlice", TranslateIntSlice))
 //
 // To use a translator for an unsupported type, add it to the "csv" struct field
 // tag. For example:
 //
-//     // Field will be marshaled with "myName" as its header name, and use
-//     // translator with name "intSlice" to translate its value.
-//     Field []int `csv:"myName,intSlice"`
+//	// Field will be marshaled with "myName" as its header name, and use
+//	// translator with name "intSlice" to translate its value.
+//	Field []int `csv:"myName,intSlice"`
+//
+// To marshal the value returned by a method instead of a field, add a
+// "method=Name" option to the "csv" struct field tag. The method must take no
+// arguments, and return a value of a supported type, optionally with an error.
+// Since the value of the field is not used, the tag could be added to a blank
+// field. For example:
+//
+//	// The returned value of FullName will be marshaled with "full_name" as its
+//	// header name.
+//	_ struct{} `csv:"full_name,method=FullName"`
+//
+// A field with a "decode=url" or "decode=html" option is escaped after being
+// marshaled, so that Unmarshal unescapes it with the same option.
 //
 // If a field has multiple ways to be marshaled, the order of using these ways
 // is:
 //
-//     1. Using the translator specified in "csv" struct field tag.
-//     2. Call MarshalText of the field.
-//     3. Use the default way to marshal the field if it is supported.
+//  1. Using the translator specified in "csv" struct field tag.
+//  2. Call MarshalText of the field.
+//  3. Use the default way to marshal the field if it is supported.
+//
+// The header row is written with the HeaderPrefix, HeaderSuffix and
+// HeaderSeparator settings, and other rows are written with the FieldPrefix and
+// FieldSuffix settings.
 func Marshal(v interface{}, settings ...Setting) ([]byte, error) {
-	return nil, nil
+	var structType = elemStructType(reflect.TypeOf(v))
+	if structType == nil {
+		return nil, fmt.Errorf("csv: Marshal(%s is not a slice or array of structs)", reflect.TypeOf(v))
+	}
+
+	var m = newMarshaler(v, settings...)
+	fields, err := marshalFields(structType, m.rule.tagKey)
+	if err != nil {
+		return nil, m.error(err)
+	}
+	if len(fields) == 0 {
+		return nil, m.error(fmt.Errorf("no %s-tagged fields in %s", m.rule.tagKey, structType))
+	}
+	return m.marshal(fields, settings)
 }
 
-func newMarshaler(v interface{}, settings ...Setting) *marshaler {
+// marshal generates a CSV document from m.v with the fields of its elements.
+func (m *marshaler) marshal(fields []*marshalField, settings []Setting) ([]byte, error) {
+	var g = NewGenerator(settings...)
+	if m.rule.writeHeader {
+		var header = make([]string, 0, len(fields)+len(m.rule.virtualColumns))
+		for _, field := range fields {
+			header = append(header, field.CSVName)
+		}
+		header = append(header, m.virtualHeader()...)
+		var err = m.writeHeader(g, header)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m.rule.fieldPrefix != noRune {
+		g.rule.prefix = m.rule.fieldPrefix
+	}
+	if m.rule.fieldSuffix != noRune {
+		g.rule.suffix = m.rule.fieldSuffix
+	}
+	var sliceV = reflect.ValueOf(m.v)
+	for i := 0; i < sliceV.Len(); i++ {
+		record, err := m.marshalRecord(sliceV.Index(i), fields)
+		if err != nil {
+			if _, ok := err.(*UnsupportedTypeError); ok {
+				return nil, err
+			}
+			return nil, m.error(fmt.Errorf("cannot marshal element #%d: %v", i, err))
+		}
+		err = g.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g.Finish()
+}
+
+// writeHeader writes the header row with the HeaderPrefix, HeaderSuffix and
+// HeaderSeparator settings.
+func (m *marshaler) writeHeader(g *Generator, header []string) error {
+	var originalPrefix = g.rule.prefix
+	var originalSuffix = g.rule.suffix
+	var originalSeparator = g.rule.separator
+	var originalSeparatorString = g.rule.separatorString
+	if m.rule.headerPrefix != noRune {
+		g.rule.prefix = m.rule.headerPrefix
+	}
+	if m.rule.headerSuffix != noRune {
+		g.rule.suffix = m.rule.headerSuffix
+	}
+	if m.rule.headerSeparator != noRune {
+		g.rule.setSeparator(m.rule.headerSeparator)
+	}
+	var err = g.Write(header)
+	g.rule.prefix = originalPrefix
+	g.rule.suffix = originalSuffix
+	g.rule.separator = originalSeparator
+	g.rule.separatorString = originalSeparatorString
+	return err
+}
+
+// marshalRecord marshals elem, which is a struct or struct pointer, to a record
+// with the fields and virtual columns.
+func (m *marshaler) marshalRecord(elem reflect.Value, fields []*marshalField) ([]string, error) {
+	var original = elem
+	for elem.Kind() == reflect.Ptr {
+		if elem.IsNil() {
+			return nil, fmt.Errorf("element is nil")
+		}
+		elem = elem.Elem()
+	}
+
+	var record = make([]string, 0, len(fields)+len(m.rule.virtualColumns))
+	for _, field := range fields {
+		var value reflect.Value
+		if field.Method != "" {
+			var err error
+			value, err = callMarshalMethod(elem, field.Method)
+			if err != nil {
+				return nil, fmt.Errorf("method %s for field %s failed: %v", field.Method, field.Name, err)
+			}
+		} else {
+			value = elem.Field(field.Index)
+		}
+
+		marshaled, err := m.marshalField(field, value)
+		if err != nil {
+			return nil, err
+		}
+		record = append(record, escapeField(field, marshaled))
+	}
+
+	virtualFields, err := m.virtualFields(original.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return append(record, virtualFields...), nil
+}
+
+// elemStructType returns the struct type of the elements in a slice or array
+// of type t, whose elements are structs or struct pointers. If t is not such a
+// type, nil will be returned.
+func elemStructType(t reflect.Type) reflect.Type {
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return nil
+	}
+	var elemType = t.Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil
+	}
+	return elemType
+}
+
+// A marshalField is a column marshaled from a struct.
+type marshalField struct {
+	Name    string // Name of the struct field.
+	Index   int    // Index of the struct field.
+	CSVName string
+	Method  string // Name of the method returning the value, empty if not set.
+	Decode  string // How the value is escaped, "url" or "html", empty if not escaped.
+	Layout  string // Layout of a time.Time field, empty if not set.
+
+	// Names in the tag which are not options, which could be translators.
+	TranslatorNames []string
+}
+
+// marshalFields returns the exported fields of structType with a struct field
+// tag of tagKey, in the order of declaration. Fields tagged with "-" are omitted.
+//
+// A field with a "method=Name" option in the tag is marshaled from the value
+// returned by the method instead, so it could be unexported, e.g. a blank
+// field like:
+//
+//	_ struct{} `csv:"full_name,method=FullName"`
+func marshalFields(structType reflect.Type, tagKey string) ([]*marshalField, error) {
+	var fields = make([]*marshalField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		var structField = structType.Field(i)
+		var tag, exist = structField.Tag.Lookup(tagKey)
+		if !exist || tag == "-" {
+			continue
+		}
+
+		tagParts, err := splitTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag of field %s: %v", structField.Name, err)
+		}
+		var field = &marshalField{
+			Name:    structField.Name,
+			Index:   i,
+			CSVName: tagParts[0],
+		}
+		var overflow = false
+		for _, part := range tagParts[1:] {
+			if part == "overflow" {
+				overflow = true
+			} else if strings.HasPrefix(part, "method=") {
+				field.Method = strings.TrimPrefix(part, "method=")
+			} else if strings.HasPrefix(part, "decode=") {
+				field.Decode = strings.TrimPrefix(part, "decode=")
+				if field.Decode != "url" && field.Decode != "html" {
+					return nil, fmt.Errorf("unknown decoding %s for field %s", field.Decode, field.Name)
+				}
+			} else if strings.HasPrefix(part, "layout=") {
+				if !isTimeType(structField.Type) {
+					return nil, fmt.Errorf("layout option for field %s of non-time type %s", field.Name, structField.Type)
+				}
+				field.Layout = strings.TrimPrefix(part, "layout=")
+			} else if part != "" && !strings.Contains(part, "=") {
+				field.TranslatorNames = append(field.TranslatorNames, part)
+			}
+		}
+
+		if overflow {
+			continue
+		}
+		if field.Method != "" {
+			var err = checkMarshalMethod(structType, field.Method)
+			if err != nil {
+				return nil, fmt.Errorf("invalid method for field %s: %v", field.Name, err)
+			}
+		} else if structField.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// checkMarshalMethod checks whether structType or its pointer type has a method
+// with the given name, which takes no arguments and returns a value,
+// optionally with an error.
+func checkMarshalMethod(structType reflect.Type, name string) error {
+	method, exist := reflect.PtrTo(structType).MethodByName(name)
+	if !exist {
+		return fmt.Errorf("method %s not found in %s", name, structType)
+	}
+	// The receiver is the first argument.
+	var t = method.Type
+	if t.NumIn() != 1 || !(t.NumOut() == 1 || (t.NumOut() == 2 && t.Out(1) == errorType)) {
+		return fmt.Errorf("method %s must take no arguments and return a value, optionally with an error", name)
+	}
 	return nil
 }
 
+// escapeField escapes value with the "decode" option of field, so that it is
+// unescaped to value while unmarshaling.
+func escapeField(field *marshalField, value string) string {
+	switch field.Decode {
+	case "url":
+		return url.QueryEscape(value)
+	case "html":
+		return html.EscapeString(value)
+	}
+	return value
+}
+
+// callMarshalMethod calls the method of v with the given name, and returns the
+// value returned by it. v is a struct value.
+func callMarshalMethod(v reflect.Value, name string) (reflect.Value, error) {
+	var method = v.MethodByName(name)
+	if !method.IsValid() {
+		// Pointer receiver.
+		var ptr = v
+		if !v.CanAddr() {
+			ptr = reflect.New(v.Type())
+			ptr.Elem().Set(v)
+		} else {
+			ptr = v.Addr()
+		}
+		method = ptr.MethodByName(name)
+	}
+
+	var out = method.Call(nil)
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, out[1].Interface().(error)
+	}
+	return out[0], nil
+}
+
+// MarshalColumn generates a single-column CSV document from values with the
+// given settings.
+//
+// values should be an array/slice of values supported by Marshal, and each of
+// them is marshaled as a record. If header is not empty, it is written as the
+// header row, unless the WriteHeader setting is disabled.
+func MarshalColumn(values interface{}, header string, settings ...Setting) ([]byte, error) {
+	var v = reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("csv: MarshalColumn(%s is not a slice or array)", reflect.TypeOf(values))
+	}
+
+	var m = newMarshaler(values, settings...)
+	var g = NewGenerator(settings...)
+	if m.rule.writeHeader && header != "" {
+		var err = g.Write([]string{header})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < v.Len(); i++ {
+		field, err := m.marshalValue(v.Index(i))
+		if err != nil {
+			if _, ok := err.(*UnsupportedTypeError); ok {
+				return nil, err
+			}
+			return nil, m.error(fmt.Errorf("cannot marshal value #%d: %v", i, err))
+		}
+		err = g.Write([]string{field})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g.Finish()
+}
+
+func newMarshaler(v interface{}, settings ...Setting) *marshaler {
+	var m = &marshaler{
+		rule: defaultRule,
+		v:    v,
+	}
+	for _, setting := range settings {
+		setting(&m.rule)
+	}
+	return m
+}
+
 type marshaler struct {
-	//
+	rule rule
+
+	v interface{}
+}
+
+func (m *marshaler) error(err error) error {
+	if !strings.HasPrefix(err.Error(), "csv: ") {
+		return fmt.Errorf("csv: %v", err)
+	}
+	return err
+}
+
+// marshalField marshals the value of field with the first translator given in
+// its tag, or with marshalValue if there is no translator.
+func (m *marshaler) marshalField(field *marshalField, value reflect.Value) (string, error) {
+	for _, name := range field.TranslatorNames {
+		translator, exist := m.rule.translators[name]
+		if !exist {
+			// Could be a validator used while unmarshaling.
+			continue
+		}
+		translated, err := translator(value.Interface())
+		if err != nil {
+			return "", fmt.Errorf("translator %s failed for field %s: %v", name, field.Name, err)
+		}
+		return string(translated), nil
+	}
+
+	if field.Layout != "" {
+		switch t := value.Interface().(type) {
+		case time.Time:
+			return m.marshalTime(t, field.Layout), nil
+		case *time.Time:
+			if t != nil {
+				return m.marshalTime(*t, field.Layout), nil
+			}
+		}
+	}
+
+	marshaled, err := m.marshalValue(value)
+	if err != nil {
+		if e, ok := err.(*UnsupportedTypeError); ok {
+			e.Field = field.Name
+			return "", e
+		}
+		return "", fmt.Errorf("cannot marshal field %s: %v", field.Name, err)
+	}
+	return marshaled, nil
+}
+
+// marshalValue marshals v to a CSV field. A nil pointer or interface is
+// marshaled to an empty field.
+func (m *marshaler) marshalValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	// time.Time implements encoding.TextMarshaler, but has to be converted to
+	// the location in the rule first.
+	if t, ok := v.Interface().(time.Time); ok {
+		return m.marshalTime(t, time.RFC3339Nano), nil
+	}
+
+	if tm, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	if v.CanAddr() {
+		if tm, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, err := tm.MarshalText()
+			return string(text), err
+		}
+	}
+
+	switch k := v.Kind(); {
+	case reflect.Int <= k && k <= reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint <= k && k <= reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case k == reflect.Float32 || k == reflect.Float64:
+		return m.marshalFloat(v.Float(), v.Type().Bits()), nil
+	case k == reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case k == reflect.String:
+		return v.String(), nil
+	}
+	return "", &UnsupportedTypeError{Type: v.Type()}
+}
+
+// marshalFloat formats f with the FloatFormat and RoundingMode settings.
+func (m *marshaler) marshalFloat(f float64, bitSize int) string {
+	var format, prec = m.rule.floatFormat, m.rule.floatPrecision
+	if m.rule.rounding == RoundNearest || format != 'f' || prec < 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+		return strconv.FormatFloat(f, format, prec, bitSize)
+	}
+	return roundDecimal(strconv.FormatFloat(f, 'f', -1, bitSize), prec, m.rule.rounding)
+}
+
+// roundDecimal rounds the decimal number s (without an exponent) to prec
+// digits after the decimal point.
+func roundDecimal(s string, prec int, mode Rounding) string {
+	var negative = strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var intPart, fracPart = s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, fracPart = s[:dot], s[dot+1:]
+	}
+	for len(fracPart) < prec {
+		fracPart += "0"
+	}
+
+	var digits = []byte(intPart + fracPart[:prec])
+	var rest = fracPart[prec:]
+	var roundUp = false
+	if len(rest) > 0 {
+		switch mode {
+		case RoundHalfUp:
+			roundUp = rest[0] >= '5'
+		case RoundHalfEven:
+			var tie = rest[0] == '5' && strings.Trim(rest[1:], "0") == ""
+			var odd = (digits[len(digits)-1]-'0')%2 == 1
+			roundUp = rest[0] > '5' || (rest[0] == '5' && !tie) || (tie && odd)
+		}
+	}
+	if roundUp {
+		var i = len(digits) - 1
+		for ; i >= 0 && digits[i] == '9'; i-- {
+			digits[i] = '0'
+		}
+		if i >= 0 {
+			digits[i]++
+		} else {
+			digits = append([]byte{'1'}, digits...)
+		}
+	}
+
+	var intLen = len(digits) - prec
+	var result = string(digits[:intLen])
+	if prec > 0 {
+		result += "." + string(digits[intLen:])
+	}
+	if negative && strings.Trim(string(digits), "0") != "" {
+		result = "-" + result
+	}
+	return result
+}
+
+// marshalTime converts t to the location set with the TimeLocation setting and
+// formats it with layout.
+func (m *marshaler) marshalTime(t time.Time, layout string) string {
+	var loc = m.rule.timeLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(layout)
+}
+
+// virtualHeader returns the header names of virtual columns.
+func (m *marshaler) virtualHeader() []string {
+	var header = make([]string, 0, len(m.rule.virtualColumns))
+	for _, column := range m.rule.virtualColumns {
+		header = append(header, column.name)
+	}
+	return header
+}
+
+// virtualFields computes the fields of virtual columns for v.
+func (m *marshaler) virtualFields(v interface{}) ([]string, error) {
+	var fields = make([]string, 0, len(m.rule.virtualColumns))
+	for _, column := range m.rule.virtualColumns {
+		field, err := column.fn(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute virtual column %s: %v", column.name, err)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// An UnsupportedTypeError is returned by Marshal when a field has a type which
+// cannot be marshaled.
+type UnsupportedTypeError struct {
+	Type  reflect.Type
+	Field string // Name of the struct field, empty if not marshaling a struct.
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	if e.Field == "" {
+		return "csv: unsupported type " + e.Type.String()
+	}
+	return "csv: unsupported type " + e.Type.String() + " for field " + e.Field
 }
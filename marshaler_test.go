@@ -0,0 +1,296 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beta/csv"
+)
+
+func TestMarshal(t *testing.T) {
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := csv.Marshal(persons)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != calendarCSV {
+		t.Errorf("output is wrong, expect %q, get %q", calendarCSV, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	// Without header, and from struct values.
+	var values = []Person{*persons[0]}
+	data, err = csv.Marshal(values, csv.WriteHeader(false))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "John,Smith,25,true,1234567890"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+	}
+}
+
+type Member struct {
+	FirstName string   `csv:"first_name"`
+	LastName  string   `csv:"last_name"`
+	_         struct{} `csv:"full_name,method=FullName"`
+	Level     int      `csv:"-,"`
+	Password  string   `csv:"-"`
+	Homepage  string   `csv:"homepage,decode=url"`
+}
+
+func (m *Member) FullName() string {
+	return m.FirstName + " " + m.LastName
+}
+
+func TestMarshalWithTagOptions(t *testing.T) {
+	var members = []*Member{
+		{FirstName: "John", LastName: "Smith", Level: 1, Password: "secret", Homepage: "a b&c"},
+	}
+	var initials = func(v interface{}) (string, error) {
+		var m = v.(*Member)
+		return m.FirstName[:1] + m.LastName[:1], nil
+	}
+	data, err := csv.Marshal(members, csv.VirtualColumn("initials", initials),
+		csv.HeaderPrefix('['), csv.HeaderSuffix(']'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "[first_name],[last_name],[full_name],[-],[homepage],[initials]\n" +
+		"John,Smith,John Smith,1,a+b%26c,JS"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	var unmarshaled []*Member
+	err = csv.Unmarshal(data, &unmarshaled, csv.HeaderPrefix('['), csv.HeaderSuffix(']'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(unmarshaled) != 1 || unmarshaled[0].Level != 1 || unmarshaled[0].Homepage != "a b&c" || unmarshaled[0].Password != "" {
+		t.Errorf("output is not unmarshaled back, get %+v", unmarshaled)
+	}
+}
+
+type Series struct {
+	Name   string `csv:"name"`
+	Points []int  `csv:"points,intSlice"`
+}
+
+func translateIntSlice(v interface{}) ([]byte, error) {
+	var ints = v.([]int)
+	if len(ints) == 0 {
+		return nil, fmt.Errorf("no points")
+	}
+	var parts = make([]string, 0, len(ints))
+	for _, i := range ints {
+		parts = append(parts, strconv.Itoa(i))
+	}
+	return []byte(strings.Join(parts, " ")), nil
+}
+
+func TestMarshalWithTranslator(t *testing.T) {
+	var series = []Series{{Name: "a", Points: []int{1, 2, 3}}}
+	data, err := csv.Marshal(series, csv.Translator("intSlice", translateIntSlice))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "name,points\na,1 2 3"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	series = append(series, Series{Name: "b"})
+	_, err = csv.Marshal(series, csv.Translator("intSlice", translateIntSlice))
+	if err == nil || !strings.Contains(err.Error(), "field Points") {
+		t.Errorf("expect an error of the translator naming the field, get %v", err)
+	}
+}
+
+func TestMarshalWithUnsupportedType(t *testing.T) {
+	var series = []Series{{Name: "a", Points: []int{1, 2, 3}}}
+	_, err := csv.Marshal(series)
+	e, ok := err.(*csv.UnsupportedTypeError)
+	if !ok {
+		t.Errorf("expect an UnsupportedTypeError, get %v", err)
+		return
+	}
+	if e.Field != "Points" || e.Type.String() != "[]int" {
+		t.Errorf("error is wrong, get %v", e)
+		return
+	}
+	t.Log(err)
+}
+
+type Order struct {
+	ID    int    `csv:"id" partner:"order_no"`
+	Notes string `csv:"notes" partner:"-"`
+	Total int    `csv:"total" partner:"amount"`
+}
+
+func TestMarshalWithTagKey(t *testing.T) {
+	var orders = []Order{{ID: 1, Notes: "gift", Total: 30}}
+	data, err := csv.Marshal(orders)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != "id,notes,total\n1,gift,30" {
+		t.Errorf("output with the csv tags is wrong, get %q", data)
+		return
+	}
+
+	data, err = csv.Marshal(orders, csv.TagKey("partner"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(data) != "order_no,amount\n1,30" {
+		t.Errorf("output with the partner tags is wrong, get %q", data)
+		return
+	}
+
+	var unmarshaled []*Order
+	err = csv.Unmarshal(data, &unmarshaled, csv.TagKey("partner"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(unmarshaled) != 1 || unmarshaled[0].ID != 1 || unmarshaled[0].Total != 30 {
+		t.Errorf("unmarshaled orders are wrong")
+	}
+}
+
+func TestMarshalColumn(t *testing.T) {
+	data, err := csv.MarshalColumn([]int{1, 2, 3}, "number")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = "number\n1\n2\n3"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	data, err = csv.MarshalColumn([]string{"aaa", "b,bb"}, "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected = "aaa\n\"b,bb\""
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	t.Log(string(data))
+
+	_, err = csv.MarshalColumn([][]int{{1}}, "")
+	if err == nil {
+		t.Errorf("unsupported type is not reported")
+	}
+}
+
+func TestMarshalColumnWithTimeLocation(t *testing.T) {
+	var instant = time.Date(2018, 1, 2, 3, 4, 5, 0, time.FixedZone("UTC+8", 8*60*60))
+
+	data, err := csv.MarshalColumn([]time.Time{instant}, "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = "2018-01-01T19:04:05Z"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+	}
+
+	data, err = csv.MarshalColumn([]time.Time{instant}, "",
+		csv.TimeLocation(time.FixedZone("UTC-5", -5*60*60)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected = "2018-01-01T14:04:05-05:00"
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+	}
+}
+
+func TestMarshalColumnWithRoundingMode(t *testing.T) {
+	var values = []float64{2.5, 3.5, -2.5, 1.005, 0.125, 9.999}
+	var cases = []struct {
+		mode     csv.Rounding
+		prec     int
+		expected string
+	}{
+		{csv.RoundHalfEven, 0, "2\n4\n-2\n1\n0\n10"},
+		{csv.RoundHalfUp, 0, "3\n4\n-3\n1\n0\n10"},
+		{csv.RoundTruncate, 0, "2\n3\n-2\n1\n0\n9"},
+		{csv.RoundHalfEven, 2, "2.50\n3.50\n-2.50\n1.00\n0.12\n10.00"},
+		{csv.RoundHalfUp, 2, "2.50\n3.50\n-2.50\n1.01\n0.13\n10.00"},
+	}
+	for _, c := range cases {
+		data, err := csv.MarshalColumn(values, "", csv.FloatFormat('f', c.prec), csv.RoundingMode(c.mode))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if string(data) != c.expected {
+			t.Errorf("output of rounding mode %d with precision %d is wrong, expect %q, get %q", c.mode, c.prec, c.expected, string(data))
+		}
+	}
+}
+
+type Untagged struct {
+	Name    string
+	Age     int `csv:"-"`
+	comment string
+}
+
+func TestMarshalWithoutTaggedFields(t *testing.T) {
+	var data, err = csv.Marshal([]Untagged{{Name: "John", Age: 25}})
+	if err == nil || !strings.Contains(err.Error(), "no csv-tagged fields in csv_test.Untagged") {
+		t.Errorf("expect an error of no csv-tagged fields, get (%q, %v)", data, err)
+		return
+	}
+	t.Log(err)
+}
+
+type Contact struct {
+	FirstName string   `csv:"first_name"`
+	LastName  string   `csv:"last_name"`
+	_         struct{} `csv:"full_name,method=Name"`
+}
+
+func TestMarshalWithInvalidMethod(t *testing.T) {
+	var data, err = csv.Marshal([]Contact{{FirstName: "John", LastName: "Smith"}})
+	if err == nil || !strings.Contains(err.Error(), "method Name not found") {
+		t.Errorf("expect an error of invalid method, get (%q, %v)", data, err)
+		return
+	}
+	t.Log(err)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Merge concatenates the CSV documents in parts, each of which starts with a
+// header row, to a single document with the given settings. The header is
+// written once, followed by the data rows of all the parts in order.
+//
+// The headers of all the parts must be the same, or an error will be returned.
+// A part which is empty is skipped.
+//
+// If the Header setting is disabled and no header names are given with the
+// HeaderNames setting, the parts have no header, and their rows are merged as
+// they are.
+func Merge(parts [][]byte, settings ...Setting) ([]byte, error) {
+	var g = NewGenerator(settings...)
+	var header []string
+	for i, part := range parts {
+		s, err := NewScanner(part, settings...)
+		if err != nil {
+			return nil, err
+		}
+		partHeader, rows, err := s.ScanAllWithHeader()
+		if err != nil {
+			return nil, fmt.Errorf("csv: part %d: %s", i+1, strings.TrimPrefix(err.Error(), "csv: "))
+		}
+		if partHeader == nil {
+			// The part is empty, or has no header.
+			err = g.WriteAll(rows)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if header == nil {
+			header = partHeader
+			err = g.Write(header)
+			if err != nil {
+				return nil, err
+			}
+		} else if !reflect.DeepEqual(partHeader, header) {
+			return nil, fmt.Errorf("csv: header %q of part %d does not match header %q", partHeader, i+1, header)
+		}
+		for _, row := range rows {
+			err = g.Write(row)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g.Finish()
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beta/csv"
+)
+
+func TestMerge(t *testing.T) {
+	var parts = [][]byte{
+		[]byte("id,name\n1,Alice\n2,Bob\n"),
+		[]byte(""),
+		[]byte("id,name\n3,\"Carol, Jr.\"\n"),
+	}
+	data, err := csv.Merge(parts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = "id,name\n1,Alice\n2,Bob\n3,\"Carol, Jr.\""
+	if string(data) != expected {
+		t.Errorf("merged document is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+
+	parts = append(parts, []byte("id,email\n4,dave@example.com\n"))
+	_, err = csv.Merge(parts)
+	if err == nil || !strings.Contains(err.Error(), "part 4") {
+		t.Errorf("mismatched header is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+
+	// Parts without a header are merged as they are.
+	parts = [][]byte{[]byte("1,Alice\n2,Bob\n"), []byte("3,Carol\n")}
+	data, err = csv.Merge(parts, csv.Header(false))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const headerless = "1,Alice\n2,Bob\n3,Carol"
+	if string(data) != headerless {
+		t.Errorf("merged document is wrong, expect %q, get %q", headerless, string(data))
+		return
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// ParallelScanAll works in the same way as ScanAll, but splits the rest of the
+// document into chunks at line breaks, and scans the chunks with the given
+// number of goroutines. The rows are returned in the order of the document.
+// For a big document, it could be much faster than ScanAll on a multi-core
+// machine.
+//
+// Splitting at line breaks only works if no field contains line breaks. Quoted
+// fields might contain line breaks, so if the rest of the document contains
+// quotes, ParallelScanAll works in the same way as ScanAll, unless the
+// SingleLineFields setting asserts that no quoted field contains line breaks.
+// It also works in the same way as ScanAll if workers is less than 2, or with
+// the ParagraphMode or AllowCRLineEnd setting. So it does with the
+// FieldTransform setting, as the function might not be safe to call
+// concurrently.
+//
+// The rest of the document is read into memory before being scanned, and the
+// progress function set with the Progress setting is called after all the
+// chunks are scanned.
+func (s *Scanner) ParallelScanAll(workers int) (rows [][]string, err error) {
+	if workers < 2 || s.rule.paragraphMode || s.rule.allowCRLineEnd || s.rule.fieldTransform != nil {
+		return s.ScanAll()
+	}
+	if s.eof {
+		return make([][]string, 0), nil
+	}
+
+	remaining, err := ioutil.ReadAll(s.f)
+	if err != nil {
+		return nil, s.error(err)
+	}
+	for _, line := range strings.SplitAfter(string(remaining), "\n") {
+		s.detectLineEnding(line)
+	}
+	if !s.rule.singleLineFields && s.containsQuote(string(s.runes[s.pos:])+string(remaining)) {
+		s.f = bufio.NewReader(bytes.NewReader(remaining))
+		return s.ScanAll()
+	}
+
+	var results [][][]string
+	if s.rule.fieldsPerRecord == 0 && s.recordFields == 0 {
+		// The number of fields is set from the first record, so it is scanned
+		// before the chunks.
+		s.f = bufio.NewReader(bytes.NewReader(remaining))
+		row, err := s.scanRecord()
+		if err != nil {
+			return nil, s.error(err)
+		}
+		results = append(results, [][]string{row})
+		remaining, err = ioutil.ReadAll(s.f)
+		if err != nil {
+			return nil, s.error(err)
+		}
+	}
+	var rest string
+	if !s.eof {
+		rest = string(s.runes[s.pos:]) + string(remaining)
+	}
+
+	var chunks = splitLines(rest, workers)
+	var chunkResults = make([][][]string, len(chunks))
+	var errs = make([]error, len(chunks))
+	var scanners = make([]*Scanner, len(chunks))
+	var wg sync.WaitGroup
+	var lineNo = s.lineNo
+	for i, chunk := range chunks {
+		scanners[i] = s.chunkScanner(chunk, lineNo, i == len(chunks)-1)
+		lineNo += strings.Count(chunk, "\n")
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chunkResults[i], errs[i] = scanners[i].scanChunk()
+		}(i)
+	}
+	wg.Wait()
+	s.eof = true
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(scanners) > 0 {
+		s.lineNo = scanners[len(scanners)-1].lineNo
+	}
+	results = append(results, chunkResults...)
+
+	rows = make([][]string, 0)
+	var totalBytes int
+	for _, result := range results {
+		for _, row := range result {
+			if s.rule.maxTotalBytes > 0 {
+				for _, field := range row {
+					totalBytes += len(field)
+				}
+				if totalBytes > s.rule.maxTotalBytes {
+					return nil, ErrResultTooLarge
+				}
+			}
+			rows = append(rows, row)
+			s.reportProgress()
+		}
+	}
+	return rows, nil
+}
+
+// containsQuote reports whether text contains a rune which could start a
+// quoted field.
+func (s *Scanner) containsQuote(text string) bool {
+	return strings.ContainsRune(text, s.rule.quote) || (s.rule.allowSingleQuote && strings.ContainsRune(text, '\''))
+}
+
+// chunkScanner returns a scanner of chunk with the rule of s. lineNo is the
+// number of the first line of chunk in the document. Every chunk but the last
+// one ends with a line break, which is not an error.
+func (s *Scanner) chunkScanner(chunk string, lineNo int, last bool) *Scanner {
+	var sub = &Scanner{
+		f:      bufio.NewReader(strings.NewReader(chunk)),
+		rule:   s.rule,
+		lineNo: lineNo - 1,
+
+		recordFields: s.recordFields,
+	}
+	sub.rule.progress = nil
+	sub.rule.maxTotalBytes = 0
+	if !last {
+		sub.rule.allowEndingLineBreakInLastRecord = true
+	}
+	return sub
+}
+
+// scanChunk scans all the rows of a scanner returned by chunkScanner.
+func (s *Scanner) scanChunk() ([][]string, error) {
+	var err = s.next()
+	if err != nil {
+		return nil, s.error(err)
+	}
+	return s.ScanAll()
+}
+
+// splitLines splits text into at most n chunks of similar sizes, each of which
+// ends with a line break, except the last one.
+func splitLines(text string, n int) []string {
+	var size = len(text)/n + 1
+	var chunks = make([]string, 0, n)
+	for len(text) > 0 {
+		var end = len(text)
+		if size < len(text) {
+			if i := strings.IndexByte(text[size:], '\n'); i >= 0 {
+				end = size + i + 1
+			}
+		}
+		chunks = append(chunks, text[:end])
+		text = text[end:]
+	}
+	return chunks
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/beta/csv"
+)
+
+func TestScannerParallelScanAll(t *testing.T) {
+	var cases = []struct {
+		data     string
+		settings []csv.Setting
+	}{
+		{"a,b,c\n1,2,3\n4,5,6\n7,8,9\n10,11,12\n", nil},
+		{"a,b,c\r\n1,2,3\r\n\r\n4,5,6\r\n7,8,9", nil},
+		{"a;b\n#comment\n1;2\n#comment\n3;4\n", []csv.Setting{csv.Separator(';'), csv.Comment('#')}},
+		{" a , b \n 1 , 2 \n\n 3 , 4 \n", []csv.Setting{csv.OmitLeadingSpace(true), csv.OmitTrailingSpace(true)}},
+		{"a,\"b\"\n1,\"2\"\n3,\"4\"\n", nil},
+		{"a,\"b\nc\"\n1,\"2\n3\"\n4,5\n", nil},
+		{"a,'b'\n1,'2'\n3,'4'\n", []csv.Setting{csv.AllowSingleQuote(true), csv.SingleLineFields(true)}},
+	}
+	for _, c := range cases {
+		for workers := 1; workers <= 4; workers++ {
+			s, err := csv.NewScanner([]byte(c.data), c.settings...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			expected, err := s.ScanAll()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			s, err = csv.NewScanner([]byte(c.data), c.settings...)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			rows, err := s.ParallelScanAll(workers)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !reflect.DeepEqual(rows, expected) {
+				t.Errorf("rows of %q with %d workers are wrong, expect %q, get %q", c.data, workers, expected, rows)
+				return
+			}
+		}
+	}
+}
+
+func TestScannerParallelScanAllAfterScan(t *testing.T) {
+	s, err := csv.NewScanner([]byte("a,b\n1,2\n3,4\n5,6\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ParallelScanAll(2)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(header, []string{"a", "b"}) || !reflect.DeepEqual(rows, [][]string{{"1", "2"}, {"3", "4"}, {"5", "6"}}) {
+		t.Errorf("rows are wrong, get header %q and rows %q", header, rows)
+		return
+	}
+	if !s.AtEOF() {
+		t.Errorf("scanner is not at EOF")
+	}
+}
+
+func TestScannerParallelScanAllWithError(t *testing.T) {
+	var data = strings.Repeat("1,2\n", 100) + "3,4,\n" + strings.Repeat("5,6\n", 100)
+	s, err := csv.NewScanner([]byte(data), csv.RejectTrailingSeparator(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ParallelScanAll(4)
+	if err == nil || !strings.Contains(err.Error(), "line 101,") {
+		t.Errorf("error is not reported at line 101, get %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+func TestScannerParallelScanAllWithFieldTransform(t *testing.T) {
+	// The transform is not safe to call concurrently, which is reported by the
+	// race detector if it is.
+	var calls int
+	var transform = func(col int, field string) string {
+		calls++
+		return strings.ToUpper(field)
+	}
+	var data = strings.Repeat("a,b\n", 100)
+	s, err := csv.NewScanner([]byte(data), csv.FieldTransform(transform))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ParallelScanAll(4)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 100 || !reflect.DeepEqual(rows[99], []string{"A", "B"}) || calls != 200 {
+		t.Errorf("rows are wrong, get %d rows ending with %q after %d calls", len(rows), rows[len(rows)-1], calls)
+	}
+}
+
+// bulkCSV is a big quote-free document.
+var bulkCSV = func() []byte {
+	var b strings.Builder
+	for i := 0; i < 200000; i++ {
+		fmt.Fprintf(&b, "%d,user%d,%d.%d,2018-01-02,active\n", i, i, i%100, i%10)
+	}
+	return []byte(b.String())
+}()
+
+func BenchmarkScannerScanAll(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(bulkCSV)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = s.ScanAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScannerParallelScanAll(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(bulkCSV)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = s.ParallelScanAll(runtime.NumCPU())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
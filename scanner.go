@@ -8,9 +8,16 @@ package csv
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
+	"iter"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/text/transform"
 )
@@ -19,39 +26,146 @@ const (
 	bom0 = 0xEF
 	bom1 = 0xBB
 	bom2 = 0xBF
+
+	bom = "\uFEFF" // BOM before being encoded.
+)
+
+// Line endings reported by Scanner.DetectedLineEnding.
+const (
+	LineEndingLF    = "\n"
+	LineEndingCRLF  = "\r\n"
+	LineEndingCR    = "\r"
+	LineEndingMixed = "mixed"
 )
 
+// ErrResultTooLarge is returned when the fields scanned by Scanner.ScanAll
+// exceed the limit set with the MaxTotalBytes setting.
+var ErrResultTooLarge = errors.New("csv: result too large")
+
 // NewScanner creates and returns a new scanner from a byte slice with the given settings.
+//
+// A document which is empty, or contains only spaces and line breaks while
+// leading and trailing spaces are omitted, has no rows. Scanning it returns
+// io.EOF immediately.
 func NewScanner(data []byte, settings ...Setting) (*Scanner, error) {
+	return NewScannerReader(bytes.NewReader(data), settings...)
+}
+
+// NewScannerReader creates and returns a new scanner reading from r with the
+// given settings. The document is read incrementally while scanning, so it
+// does not have to be kept in memory as a whole.
+func NewScannerReader(r io.Reader, settings ...Setting) (*Scanner, error) {
 	var s = &Scanner{
 		rule: defaultRule,
 	}
 	for _, setting := range settings {
 		setting(&s.rule)
 	}
+	if s.rule.err != nil {
+		return nil, s.rule.err
+	}
+
+	if s.rule.compression == Gzip {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	}
 
-	s.f = bufio.NewReader(transform.NewReader(bytes.NewReader(data), s.rule.encoding.NewDecoder()))
 	if s.rule.ignoreBOM {
-		s.ignoreBOM()
+		// A UTF-8 BOM is not decoded correctly by single-byte encodings (e.g.
+		// Windows-1252), so it is removed before decoding.
+		r = skipRawBOM(r)
 	}
-	var err = s.next()
+
+	r = transform.NewReader(r, s.rule.encoding.NewDecoder())
+	if s.rule.omitLeadingSpace && s.rule.omitTrailingSpace && !s.rule.emptyLineIsRecord {
+		var err error
+		r, err = skipBlankDocument(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.f = bufio.NewReader(r)
+	if s.rule.ignoreBOM {
+		// A UTF-16 BOM is decoded to a BOM at the start of the document.
+		if b, err := s.f.Peek(len(bom)); err == nil && string(b) == bom {
+			s.f.Discard(len(bom))
+		}
+	}
+	var err = s.skipLines(s.rule.skipRows)
+	if err != nil {
+		return nil, err
+	}
+	err = s.next()
 	if err != nil {
 		return nil, err
 	}
 	return s, nil
 }
 
+// skipLines discards the first n lines of the document, as set with the
+// SkipRows setting.
+func (s *Scanner) skipLines(n int) error {
+	for i := 0; i < n && !s.lastLine; i++ {
+		var err = s.readNextLine()
+		if err != nil {
+			return err
+		}
+		s.lineNo++
+	}
+	s.line, s.runes = "", nil
+	return nil
+}
+
 // A Scanner scans a CSV document and returns the scanned header and rows.
 type Scanner struct {
 	f    *bufio.Reader
 	rule rule
 
 	line     string
+	runes    []rune // Runes of the current line, decoded once per line.
 	lineNo   int
 	pos      int
 	c        rune
 	eof      bool
 	lastLine bool
+	crLine   bool // Whether the current line ends with a bare \r, read as \n.
+
+	discard     bool     // Whether scanned fields are discarded instead of being collected.
+	reuse       bool     // Whether the scanned record is put into record.
+	record      []string // Record reused with the ReuseRecord setting.
+	raw         []byte   // Raw content of the current record, nil if not recorded.
+	recordCount int
+	lineEnding  string
+
+	header        []string // Header row scanned with ScanHeader.
+	headerScanned bool
+
+	recordFields int // Number of fields in the first record, set with FieldsPerRecord(0).
+}
+
+// AtEOF reports whether the scanner has reached the end of the CSV document,
+// i.e. there is no more row to be scanned.
+func (s *Scanner) AtEOF() bool {
+	return s.eof
+}
+
+// Line returns the number of the line where s is in the document, starting
+// from 1. After Scan returns a row, it is the line where the next row starts,
+// and after Scan returns an error, it is the line where the error occurs, as
+// given in the error.
+func (s *Scanner) Line() int {
+	return s.lineNo
+}
+
+// Position returns the index of the rune in the current line where s is,
+// starting from 0, in the same way as Line. It is the position given in
+// scanning errors.
+func (s *Scanner) Position() int {
+	return s.pos
 }
 
 // Setting applies settings for s.
@@ -65,37 +179,522 @@ func (s *Scanner) Setting(settings ...Setting) {
 //
 // If an error occurs, row will be returned as nil.
 //
-// If there is no more row to be scanned, io.EOF will be returned.
+// If there is no more row to be scanned, io.EOF will be returned. The last row
+// is returned with a nil error, whether or not it ends with a line break, and
+// the next call to Scan returns io.EOF.
 func (s *Scanner) Scan() (row []string, err error) {
 	if s.eof {
 		return nil, io.EOF
 	}
 
-	row, err = s.scanRecord()
+	row, err = s.scanReusableRecord()
 	if err != nil {
 		return nil, s.error(err)
 	}
+	s.reportProgress()
+	return
+}
+
+// ScanInto scans the next row from the CSV document, and returns only the
+// fields in the given columns, in the order of cols. Other fields are scanned
+// without being collected.
+//
+// If a column is missing in the row, an error will be returned, unless the
+// AllowMissingColumns setting is enabled, in which case an empty field will be
+// returned for the column.
+//
+// Like Scan, if there is no more row to be scanned, io.EOF will be returned.
+func (s *Scanner) ScanInto(cols []int) (fields []string, err error) {
 	if s.eof {
-		err = io.EOF
+		return nil, io.EOF
+	}
+
+	fields, err = s.scanRecordInto(cols)
+	if err != nil {
+		return nil, s.error(err)
 	}
+	s.reportProgress()
 	return
 }
 
+// ScanWithHash scans the next row from the CSV document like Scan, and also
+// returns a 64-bit FNV-1a hash of the raw content of the row, which could be
+// used to find duplicated rows. The raw content is decoded text without the
+// ending line break, so the hash of a row does not depend on the encoding of
+// the document, or whether it is the last row.
+func (s *Scanner) ScanWithHash() (row []string, hash uint64, err error) {
+	if s.eof {
+		return nil, 0, io.EOF
+	}
+
+	s.raw = make([]byte, 0, len(s.line))
+	defer func() { s.raw = nil }()
+	row, err = s.scanReusableRecord()
+	if err != nil {
+		return nil, 0, s.error(err)
+	}
+	s.reportProgress()
+
+	var raw = bytes.TrimSuffix(s.raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	var h = fnv.New64a()
+	h.Write(raw)
+	return row, h.Sum64(), nil
+}
+
 // ScanAll scans the rest rows of the CSV document.
 //
 // If an error occurs, rows will be returned as nil.
 func (s *Scanner) ScanAll() (rows [][]string, err error) {
 	rows = make([][]string, 0)
+	var totalBytes int
 	for !s.eof {
 		row, err := s.scanRecord()
 		if err != nil {
 			return nil, s.error(err)
 		}
+		if s.rule.maxTotalBytes > 0 {
+			for _, field := range row {
+				totalBytes += len(field)
+			}
+			if totalBytes > s.rule.maxTotalBytes {
+				return nil, ErrResultTooLarge
+			}
+		}
 		rows = append(rows, row)
+		s.reportProgress()
 	}
 	return
 }
 
+// ScanFunc scans the rest rows of the CSV document one by one, and calls fn
+// with each row, so that the rows do not have to be kept in memory as a whole.
+//
+// If fn returns an error, ScanFunc stops scanning and returns the error as it
+// is. At the end of the document, nil will be returned.
+func (s *Scanner) ScanFunc(fn func(row []string) error) error {
+	for !s.eof {
+		row, err := s.scanReusableRecord()
+		if err != nil {
+			return s.error(err)
+		}
+		s.reportProgress()
+		err = fn(row)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rows returns an iterator over the rest rows of the CSV document, which calls
+// Scan for each row, e.g.
+//
+//	for row, err := range s.Rows() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+//
+// If an error occurs, it is yielded with a nil row, and the iteration stops.
+// The iteration ends at the end of the document without yielding io.EOF.
+func (s *Scanner) Rows() iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		for {
+			row, err := s.Scan()
+			if err == io.EOF {
+				return
+			}
+			if !yield(row, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// DistinctColumn scans the rest rows of the CSV document, and returns the set
+// of distinct values in the given column. Other fields are scanned without
+// being collected.
+//
+// Like ScanInto, if the column is missing in a row, an error will be returned,
+// unless the AllowMissingColumns setting is enabled.
+func (s *Scanner) DistinctColumn(col int) (values map[string]struct{}, err error) {
+	values = make(map[string]struct{})
+	var cols = []int{col}
+	for !s.eof {
+		fields, err := s.scanRecordInto(cols)
+		if err != nil {
+			return nil, s.error(err)
+		}
+		values[fields[0]] = struct{}{}
+		s.reportProgress()
+	}
+	return
+}
+
+// Validate scans the rest rows of the CSV document, and checks whether each
+// field is valid for the type of its column set with the ColumnTypes setting.
+// Empty fields are not checked.
+//
+// An error is returned in invalid for each invalid field, while err is only
+// returned if the document could not be scanned.
+func (s *Scanner) Validate() (invalid []*FieldError, err error) {
+	for !s.eof {
+		var lineNo = s.lineNo
+		row, err := s.scanRecord()
+		if err != nil {
+			return nil, s.error(err)
+		}
+		for col, field := range row {
+			columnType, exist := s.rule.columnTypes[col]
+			if !exist || field == "" {
+				continue
+			}
+			if !isValidField(field, columnType) {
+				invalid = append(invalid, &FieldError{Line: lineNo, Column: col, Field: field, Type: columnType})
+			}
+		}
+		s.reportProgress()
+	}
+	return invalid, nil
+}
+
+// InferTypes scans at most sample rows from the CSV document, and infers the
+// type of each column from them. The type of a column is the most specific one
+// in IntColumn, FloatColumn, BoolColumn and DateColumn which all the sampled
+// fields are valid for, or StringColumn if there is none. Empty fields are
+// ignored, so a column with only empty fields is a StringColumn.
+//
+// The sampled rows are consumed, and the length of types is the max number of
+// fields in them.
+func (s *Scanner) InferTypes(sample int) (types []ColumnType, err error) {
+	var rows [][]string
+	for i := 0; i < sample && !s.eof; i++ {
+		row, err := s.scanRecord()
+		if err != nil {
+			return nil, s.error(err)
+		}
+		s.reportProgress()
+		rows = append(rows, row)
+	}
+	return inferTypes(rows), nil
+}
+
+// inferTypes infers the type of each column from rows in the same way as
+// Scanner.InferTypes.
+func inferTypes(rows [][]string) []ColumnType {
+	var candidates = []ColumnType{IntColumn, FloatColumn, BoolColumn, DateColumn}
+	var valid [][]bool // Whether each candidate is valid for each column.
+	var seen []bool    // Whether a non-empty field is found in each column.
+	for _, row := range rows {
+		for col, field := range row {
+			if col >= len(valid) {
+				var all = make([]bool, len(candidates))
+				for j := range all {
+					all[j] = true
+				}
+				valid = append(valid, all)
+				seen = append(seen, false)
+			}
+			if field == "" {
+				continue
+			}
+			seen[col] = true
+			for j, candidate := range candidates {
+				if valid[col][j] && !isValidField(field, candidate) {
+					valid[col][j] = false
+				}
+			}
+		}
+	}
+
+	var types = make([]ColumnType, len(valid))
+	for col := range valid {
+		types[col] = StringColumn
+		if !seen[col] {
+			continue
+		}
+		for j, candidate := range candidates {
+			if valid[col][j] {
+				types[col] = candidate
+				break
+			}
+		}
+	}
+	return types
+}
+
+// A FieldError describes a field which is invalid for the type of its column.
+type FieldError struct {
+	Line   int // Line number of the record, starting from 1.
+	Column int // Column index, starting from 0.
+	Field  string
+	Type   ColumnType
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("csv: line %d, column %d: %q is not a valid %s", e.Line, e.Column, e.Field, e.Type)
+}
+
+// isValidField reports whether field is a valid value of columnType.
+func isValidField(field string, columnType ColumnType) bool {
+	var err error
+	switch columnType {
+	case IntColumn:
+		_, err = strconv.ParseInt(field, 10, 64)
+	case FloatColumn:
+		_, err = strconv.ParseFloat(field, 64)
+	case BoolColumn:
+		_, err = strconv.ParseBool(field)
+	case DateColumn:
+		_, err = time.Parse("2006-01-02", field)
+	}
+	return err == nil
+}
+
+// ScanAllWithHeader scans the rest rows of the CSV document, and returns the
+// header row separately from the data rows.
+//
+// If the Header setting is disabled, the first row is treated as data, and
+// header will be nil unless the HeaderNames setting is given. If HeaderNames
+// is given, it is returned as header instead of the scanned header row.
+//
+// The HeaderPrefix and HeaderSuffix settings are used for the header row, and
+// the FieldPrefix and FieldSuffix settings are used for data rows. With the
+// NormalizeToHeader setting, data rows are normalized to the length of header.
+//
+// If an error occurs, header and rows will be returned as nil.
+func (s *Scanner) ScanAllWithHeader() (header []string, rows [][]string, err error) {
+	header, err = s.scanValidHeader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var originalPrefix = s.rule.prefix
+	var originalSuffix = s.rule.suffix
+	if s.rule.fieldPrefix != noRune {
+		s.rule.prefix = s.rule.fieldPrefix
+	}
+	if s.rule.fieldSuffix != noRune {
+		s.rule.suffix = s.rule.fieldSuffix
+	}
+	rows, err = s.ScanAll()
+	s.rule.prefix = originalPrefix
+	s.rule.suffix = originalSuffix
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if s.rule.normalizeToHeader && header != nil {
+		for i, row := range rows {
+			rows[i], err = s.normalizeRow(row, len(header))
+			if err != nil {
+				return nil, nil, fmt.Errorf("csv: data row %d: %v", i+1, err)
+			}
+		}
+	}
+	return header, rows, nil
+}
+
+// scanValidHeader scans the header row like ScanHeader, and checks it with the
+// ValidateHeader setting. If the document has no row, the header names given
+// with the HeaderNames setting are returned.
+func (s *Scanner) scanValidHeader() ([]string, error) {
+	header, err := s.ScanHeader()
+	if err == io.EOF {
+		header, err = s.rule.headerNames, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.rule.validateHeader != nil && header != nil {
+		err = s.rule.validateHeader(header)
+		if err != nil {
+			return nil, fmt.Errorf("csv: invalid header %q: %v", header, err)
+		}
+	}
+	return header, nil
+}
+
+// scanDataRow scans the next data row like Scan, with the FieldPrefix and
+// FieldSuffix settings, and normalizes it to the length of header with the
+// NormalizeToHeader setting in the same way as ScanAllWithHeader. index is the
+// number of the data row used in errors, starting from 1.
+//
+// If there is no more row to be scanned, io.EOF will be returned.
+func (s *Scanner) scanDataRow(header []string, index int) ([]string, error) {
+	var originalPrefix = s.rule.prefix
+	var originalSuffix = s.rule.suffix
+	if s.rule.fieldPrefix != noRune {
+		s.rule.prefix = s.rule.fieldPrefix
+	}
+	if s.rule.fieldSuffix != noRune {
+		s.rule.suffix = s.rule.fieldSuffix
+	}
+	row, err := s.Scan()
+	s.rule.prefix = originalPrefix
+	s.rule.suffix = originalSuffix
+	if err != nil {
+		return nil, err
+	}
+
+	if s.rule.normalizeToHeader && header != nil {
+		row, err = s.normalizeRow(row, len(header))
+		if err != nil {
+			return nil, fmt.Errorf("csv: data row %d: %v", index, err)
+		}
+	}
+	return row, nil
+}
+
+// normalizeRow pads row with empty fields, or truncates it if the
+// TruncateLongRows setting is enabled, so that it has n fields.
+func (s *Scanner) normalizeRow(row []string, n int) ([]string, error) {
+	if len(row) > n {
+		if !s.rule.truncateLongRows {
+			return nil, fmt.Errorf("%d fields found but the header has %d columns", len(row), n)
+		}
+		return row[:n], nil
+	}
+	for len(row) < n {
+		row = append(row, "")
+	}
+	return row, nil
+}
+
+// ScanHeader scans the header row of the CSV document, which is the first row
+// not omitted by the OmitEmptyLine and Comment settings. After calling
+// ScanHeader, Scan and other methods return only data rows. ScanHeader should
+// be called before scanning any row, and calling it again returns the same
+// header without scanning.
+//
+// If the Header setting is disabled, no row is scanned, and header will be nil
+// unless the HeaderNames setting is given. If HeaderNames is given, it is
+// returned as header instead of the scanned header row.
+//
+// If the document has no row, io.EOF will be returned.
+func (s *Scanner) ScanHeader() (header []string, err error) {
+	if !s.headerScanned {
+		if s.rule.header {
+			if s.eof {
+				return nil, io.EOF
+			}
+			s.header, err = s.scanHeader()
+			if err != nil {
+				return nil, s.error(err)
+			}
+		}
+		s.headerScanned = true
+	}
+
+	if s.rule.headerNames != nil {
+		return s.rule.headerNames, nil
+	}
+	return s.header, nil
+}
+
+// scanHeader scans the header row with the HeaderPrefix, HeaderSuffix and
+// HeaderSeparator settings. The FieldTransform setting is not applied to the
+// header row.
+func (s *Scanner) scanHeader() ([]string, error) {
+	var originalPrefix = s.rule.prefix
+	var originalSuffix = s.rule.suffix
+	var originalSeparator = s.rule.separator
+	var originalSeparatorString = s.rule.separatorString
+	var originalTransform = s.rule.fieldTransform
+	s.rule.fieldTransform = nil
+	if s.rule.headerPrefix != noRune {
+		s.rule.prefix = s.rule.headerPrefix
+	}
+	if s.rule.headerSuffix != noRune {
+		s.rule.suffix = s.rule.headerSuffix
+	}
+	if s.rule.headerSeparator != noRune {
+		s.rule.setSeparator(s.rule.headerSeparator)
+	}
+	header, err := s.scanRecord()
+	s.rule.prefix = originalPrefix
+	s.rule.suffix = originalSuffix
+	s.rule.separator = originalSeparator
+	s.rule.separatorString = originalSeparatorString
+	s.rule.fieldTransform = originalTransform
+	return header, err
+}
+
+// CountRecords counts the rest records of the CSV document without collecting
+// the content of fields. Quoted fields are still honored, so line breaks in
+// fields do not count as record ends.
+//
+// After calling CountRecords, the scanner reaches the end of the document.
+func (s *Scanner) CountRecords() (count int, err error) {
+	s.discard = true
+	defer func() { s.discard = false }()
+
+	for !s.eof {
+		_, err := s.scanRecord()
+		if err != nil {
+			return 0, s.error(err)
+		}
+		count++
+		s.reportProgress()
+	}
+	return
+}
+
+// reportProgress counts a scanned record, and calls the progress function if
+// necessary.
+func (s *Scanner) reportProgress() {
+	s.recordCount++
+	if s.rule.progress != nil && s.rule.progressEvery > 0 && s.recordCount%s.rule.progressEvery == 0 {
+		s.rule.progress(s.recordCount)
+	}
+}
+
+// Describe returns a human-readable summary of the settings used by s, one per
+// line, which helps to find out the settings in effect after applying presets
+// and overrides.
+func (s *Scanner) Describe() string {
+	return s.rule.describe(
+		"single quotes: "+strconv.FormatBool(s.rule.allowSingleQuote),
+		"empty fields: "+strconv.FormatBool(s.rule.allowEmptyField),
+		"omit leading space: "+strconv.FormatBool(s.rule.omitLeadingSpace),
+		"omit trailing space: "+strconv.FormatBool(s.rule.omitTrailingSpace),
+		"omit empty lines: "+strconv.FormatBool(s.rule.omitEmptyLine),
+		"ignore BOM: "+strconv.FormatBool(s.rule.ignoreBOM),
+	)
+}
+
+// DetectedLineEnding returns the line ending used in the part of the document
+// scanned so far, which is one of LineEndingLF, LineEndingCRLF, LineEndingCR
+// and LineEndingMixed. If no line ending has been found, an empty string will
+// be returned.
+func (s *Scanner) DetectedLineEnding() string {
+	return s.lineEnding
+}
+
+// detectLineEnding updates the detected line ending with the line end of line,
+// a physical line read with readNextLine. Carriage returns elsewhere in the
+// line are a part of the fields, and not line ends.
+func (s *Scanner) detectLineEnding(line string) {
+	var lineEnding string
+	switch {
+	case strings.HasSuffix(line, "\r\n"):
+		lineEnding = LineEndingCRLF
+	case strings.HasSuffix(line, "\n"):
+		lineEnding = LineEndingLF
+	case s.rule.allowCRLineEnd && strings.HasSuffix(line, "\r"):
+		lineEnding = LineEndingCR
+	default:
+		return
+	}
+	if s.lineEnding == "" {
+		s.lineEnding = lineEnding
+	} else if s.lineEnding != lineEnding {
+		s.lineEnding = LineEndingMixed
+	}
+}
+
 // error wraps a scanning error with the current position in the CSV document.
 func (s *Scanner) error(err error) error {
 	return fmt.Errorf("csv: Scanner failed at line %d, pos %d: %v", s.lineNo, s.pos, err)
@@ -103,20 +702,30 @@ func (s *Scanner) error(err error) error {
 
 // next moves to the next rune in the document.
 func (s *Scanner) next() error {
-	if s.pos >= len([]rune(s.line))-1 {
+	if s.pos >= len(s.runes)-1 {
 		return s.nextLine()
 	}
 	s.pos++
-	s.c = []rune(s.line)[s.pos]
+	s.c = s.runes[s.pos]
 	return nil
 }
 
+// peek returns the rune after the current one in the current line. If the
+// current rune is the last one in the line, ok will be false.
+func (s *Scanner) peek() (c rune, ok bool) {
+	if s.pos+1 >= len(s.runes) {
+		return noRune, false
+	}
+	return s.runes[s.pos+1], true
+}
+
 // nextLine reads the next line into s.line, and updates s.c and s.pos to the
 // first rune of the new line.
 //
 // If the new line is the last line of the document, s.lastLine will be set
 // true. If the last line is empty, s.eof will be set true.
 func (s *Scanner) nextLine() error {
+	s.recordLine()
 	s.lineNo++
 	var err = s.readNextLine()
 	if err != nil {
@@ -133,33 +742,70 @@ func (s *Scanner) nextLine() error {
 	}
 
 	s.pos = 0
-	if len([]rune(s.line)) <= 0 && s.lastLine {
+	if len(s.runes) <= 0 && s.lastLine {
 		s.eof = true
 		s.c = noRune
 		if !s.rule.allowEndingLineBreakInLastRecord {
 			return fmt.Errorf("unexpected empty line")
 		}
+		// There is no new line, so errors at the end of the document are located
+		// in the last line.
+		s.lineNo--
 		return nil
 	}
-	s.c = []rune(s.line)[0]
+	s.c = s.runes[0]
+	return nil
+}
+
+// skipConcatenatedBOM skips a BOM at the start of the line where a record
+// starts, which is left by concatenating documents, if the IgnoreBOM setting
+// is enabled. A BOM at the start of a line inside a quoted field is kept.
+func (s *Scanner) skipConcatenatedBOM() error {
+	if s.rule.ignoreBOM && s.pos == 0 && !s.eof && s.c == '\uFEFF' {
+		return s.next()
+	}
 	return nil
 }
 
+// recordLine appends the current line to the raw content of the current record
+// if it is being recorded.
+func (s *Scanner) recordLine() {
+	if s.raw != nil {
+		s.raw = append(s.raw, s.line...)
+	}
+}
+
 func (s *Scanner) shouldOmitLine(line string) bool {
 	// Empty line (only with a line break).
-	if line == "\n" && s.rule.omitEmptyLine {
+	if line == "\n" && s.rule.omitEmptyLine && !s.rule.emptyLineIsRecord {
 		return true
 	}
 	// Comment.
-	if s.rule.comment != noRune && len([]rune(line)) > 0 && []rune(line)[0] == s.rule.comment {
+	if s.rule.comment != noRune && strings.HasPrefix(line, string(s.rule.comment)) {
 		return true
 	}
 	return false
 }
 
+// readNextLine reads the next line into s.line. The line end of the line, \r\n
+// or a bare \r with the AllowCRLineEnd setting, is replaced with \n, so \n is
+// the only line end seen while scanning.
 func (s *Scanner) readNextLine() error {
 	var err error
-	s.line, err = s.f.ReadString('\n')
+	if s.rule.allowCRLineEnd {
+		s.line, err = s.readCRLine()
+	} else {
+		s.line, err = s.f.ReadString('\n')
+	}
+	s.detectLineEnding(s.line)
+	s.crLine = false
+	if strings.HasSuffix(s.line, "\r\n") {
+		s.line = s.line[:len(s.line)-2] + "\n"
+	} else if s.rule.allowCRLineEnd && strings.HasSuffix(s.line, "\r") {
+		s.line = s.line[:len(s.line)-1] + "\n"
+		s.crLine = true
+	}
+	s.runes = []rune(s.line)
 	if err != nil {
 		if err == io.EOF {
 			s.lastLine = true
@@ -170,15 +816,63 @@ func (s *Scanner) readNextLine() error {
 	return nil
 }
 
+// readCRLine reads a line ending with \n, \r\n or a bare \r.
+func (s *Scanner) readCRLine() (string, error) {
+	var line []byte
+	for {
+		b, err := s.f.ReadByte()
+		if err != nil {
+			return string(line), err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			return string(line), nil
+		}
+		if b == '\r' {
+			if next, err := s.f.Peek(1); err == nil && next[0] == '\n' {
+				s.f.ReadByte()
+				line = append(line, '\n')
+			}
+			return string(line), nil
+		}
+	}
+}
+
 func (s *Scanner) scanRecord() ([]string, error) {
-	var fields = make([]string, 0)
+	if s.rule.paragraphMode {
+		return s.scanParagraph()
+	}
+	var err = s.skipConcatenatedBOM()
+	if err != nil {
+		return nil, err
+	}
+	if s.rule.emptyLineIsRecord && s.pos == 0 && s.line == "\n" {
+		err = s.checkFieldCount(1)
+		if err != nil {
+			return nil, err
+		}
+		return s.scanEmptyLine()
+	}
+
+	var fields []string
+	if s.reuse {
+		fields = s.record[:0]
+	} else if !s.discard {
+		fields = make([]string, 0)
+	}
 	field, err := s.scanField()
 	if err != nil {
 		return nil, err
 	}
-	fields = append(fields, field)
+	if !s.discard {
+		fields = append(fields, s.transformField(0, field))
+	}
 
-	for !s.eof && !s.isLineEnd(s.c) {
+	var col = 1
+	for ; !s.eof && !s.isLineEnd(s.c) && !s.isTrailingComment(s.c); col++ {
+		if s.rule.rejectTrailingSeparator && s.isTrailingSeparator() {
+			return nil, fmt.Errorf("trailing separator at the end of the record")
+		}
 		_, err := s.scanCOMMA()
 		if err != nil {
 			return nil, err
@@ -188,7 +882,199 @@ func (s *Scanner) scanRecord() ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		fields = append(fields, field)
+		if !s.discard {
+			fields = append(fields, s.transformField(col, field))
+		}
+	}
+
+	// col is the number of fields now.
+	err = s.checkFieldCount(col)
+	if err != nil {
+		return nil, err
+	}
+	err = s.nextLine()
+	if err != nil {
+		return nil, err
+	}
+	if s.reuse {
+		s.record = fields
+	}
+	return fields, nil
+}
+
+// scanReusableRecord scans a record like scanRecord. With the ReuseRecord
+// setting, the record is backed by the one scanned last time.
+func (s *Scanner) scanReusableRecord() ([]string, error) {
+	if !s.rule.reuseRecord {
+		return s.scanRecord()
+	}
+	s.reuse = true
+	defer func() { s.reuse = false }()
+	return s.scanRecord()
+}
+
+// scanEmptyLine scans an empty line as a record with a single empty field.
+func (s *Scanner) scanEmptyLine() ([]string, error) {
+	var err = s.nextLine()
+	if err != nil {
+		return nil, err
+	}
+	if s.discard {
+		return nil, nil
+	}
+	return []string{s.transformField(0, "")}, nil
+}
+
+// scanParagraph scans a record in paragraph mode, where each line is a field,
+// and records are separated by blank lines.
+func (s *Scanner) scanParagraph() ([]string, error) {
+	var fields []string
+	if !s.discard {
+		fields = make([]string, 0)
+	}
+	for col := 0; ; col++ {
+		if !s.discard {
+			var field = strings.TrimSuffix(s.line, "\n")
+			if s.rule.omitLeadingSpace {
+				field = strings.TrimLeftFunc(field, s.isSpace)
+			}
+			if s.rule.omitTrailingSpace {
+				field = strings.TrimRightFunc(field, s.isSpace)
+			}
+			if s.rule.requireValidUTF8 && !isValidUTF8(field) {
+				return nil, fmt.Errorf("invalid UTF-8 in field %q", field)
+			}
+			fields = append(fields, s.transformField(col, field))
+		}
+
+		end, err := s.nextParagraphLine()
+		if err != nil {
+			return nil, err
+		}
+		if end {
+			return fields, nil
+		}
+	}
+}
+
+// scanParagraphInto scans a record in paragraph mode, and returns the fields in
+// cols.
+func (s *Scanner) scanParagraphInto(cols []int) ([]string, error) {
+	record, err := s.scanParagraph()
+	if err != nil {
+		return nil, err
+	}
+	var fields = make([]string, len(cols))
+	for i, col := range cols {
+		if col < len(record) {
+			fields[i] = record[col]
+		} else if !s.rule.allowMissingColumns {
+			return nil, fmt.Errorf("column %d not found", col)
+		}
+	}
+	return fields, nil
+}
+
+// nextParagraphLine reads the next line in paragraph mode, skipping comments.
+// If the line is blank, the following blank lines are skipped too, and end
+// will be true since the current record ends. end will also be true at the end
+// of the document.
+func (s *Scanner) nextParagraphLine() (end bool, err error) {
+	s.recordLine()
+	for {
+		if s.lastLine {
+			s.eof = true
+			s.c = noRune
+			return true, nil
+		}
+		s.lineNo++
+		err = s.readNextLine()
+		if err != nil {
+			return false, err
+		}
+
+		if s.isBlankLine(s.line) {
+			end = true
+		} else if s.rule.comment == noRune || !strings.HasPrefix(s.line, string(s.rule.comment)) {
+			break
+		}
+	}
+
+	s.pos = 0
+	s.c = s.runes[0]
+	return end, nil
+}
+
+// isBlankLine reports whether line contains only spaces and a line break.
+func (s *Scanner) isBlankLine(line string) bool {
+	return strings.TrimFunc(strings.TrimSuffix(line, "\n"), s.isSpace) == ""
+}
+
+// transformField applies the FieldTransform setting to field in column col.
+func (s *Scanner) transformField(col int, field string) string {
+	if s.rule.fieldTransform == nil {
+		return field
+	}
+	return s.rule.fieldTransform(col, field)
+}
+
+// scanRecordInto scans a record, and returns the fields in cols.
+func (s *Scanner) scanRecordInto(cols []int) ([]string, error) {
+	if s.rule.paragraphMode {
+		return s.scanParagraphInto(cols)
+	}
+	var err = s.skipConcatenatedBOM()
+	if err != nil {
+		return nil, err
+	}
+
+	var wanted = make(map[int][]int, len(cols)) // Column index to indexes in fields.
+	for i, col := range cols {
+		wanted[col] = append(wanted[col], i)
+	}
+	var fields = make([]string, len(cols))
+	var found = make([]bool, len(cols))
+
+	defer func() { s.discard = false }()
+	var count int // Number of fields in the record.
+	for col := 0; ; col++ {
+		if col > 0 {
+			if s.eof || s.isLineEnd(s.c) || s.isTrailingComment(s.c) {
+				count = col
+				break
+			}
+			if s.rule.rejectTrailingSeparator && s.isTrailingSeparator() {
+				return nil, fmt.Errorf("trailing separator at the end of the record")
+			}
+			_, err := s.scanCOMMA()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		indexes, isWanted := wanted[col]
+		s.discard = !isWanted
+		field, err := s.scanField()
+		if err != nil {
+			return nil, err
+		}
+		if isWanted {
+			field = s.transformField(col, field)
+		}
+		for _, i := range indexes {
+			fields[i] = field
+			found[i] = true
+		}
+	}
+
+	err = s.checkFieldCount(count)
+	if err != nil {
+		return nil, err
+	}
+	for i, col := range cols {
+		if !found[i] && !s.rule.allowMissingColumns {
+			return nil, fmt.Errorf("column %d not found", col)
+		}
 	}
 
 	err = s.nextLine()
@@ -198,6 +1084,26 @@ func (s *Scanner) scanRecord() ([]string, error) {
 	return fields, nil
 }
 
+// checkFieldCount checks the number of fields n in the current record with the
+// FieldsPerRecord setting.
+func (s *Scanner) checkFieldCount(n int) error {
+	var expected = s.rule.fieldsPerRecord
+	if expected < 0 {
+		return nil
+	}
+	if expected == 0 {
+		if s.recordFields == 0 {
+			s.recordFields = n
+			return nil
+		}
+		expected = s.recordFields
+	}
+	if n != expected {
+		return fmt.Errorf("wrong number of fields, expect %d, get %d", expected, n)
+	}
+	return nil
+}
+
 // scanField scans and returns a field.
 //
 // If the field starts with a quote, scanField scans until a matching quote is
@@ -219,7 +1125,7 @@ func (s *Scanner) scanField() (string, error) {
 			if err != nil {
 				return "", err
 			}
-		} else {
+		} else if !s.rule.optionalAffix {
 			return "", fmt.Errorf("prefix not found")
 		}
 	}
@@ -232,13 +1138,14 @@ func (s *Scanner) scanField() (string, error) {
 			return "", err
 		}
 		if s.rule.suffix != noRune {
-			if s.c != s.rule.suffix {
+			if s.c == s.rule.suffix {
+				err = s.next()
+				if err != nil {
+					return "", err
+				}
+			} else if !s.rule.optionalAffix {
 				return "", fmt.Errorf("suffix not found")
 			}
-			err = s.next()
-			if err != nil {
-				return "", err
-			}
 		}
 	} else {
 		field, err = s.scanNonEscaped()
@@ -255,24 +1162,73 @@ func (s *Scanner) scanField() (string, error) {
 		}
 	}
 
+	if s.rule.requireValidUTF8 && !isValidUTF8(field) {
+		return "", fmt.Errorf("invalid UTF-8 in field %q", field)
+	}
 	return field, nil
 }
 
+// scanEscaped scans a quoted field. Only the quote which the field starts with
+// ends the field, and is escaped by doubling it. The other quote allowed with
+// the AllowSingleQuote setting is a literal character in the field, and is
+// never unescaped, e.g. 'a""b' is scanned to a""b.
+//
+// If an escape rune is set with the EscapeChar setting, it escapes the rune
+// after it, which is unescaped with unescapeRune.
 func (s *Scanner) scanEscaped() (string, error) {
-	leadingQuote, err := s.scanQUOTE()
+	var leadingQuote = s.c
+	_, err := s.scanQUOTE()
 	if err != nil {
 		return "", err
 	}
 
-	var escaped string
+	var escaped strings.Builder
+	if s.rule.rawQuotes && !s.discard {
+		escaped.WriteRune(leadingQuote)
+	}
 	var foundFirstQuote = false
 	for !s.eof {
+		if !foundFirstQuote && s.rule.escapeChar != noRune && s.c == s.rule.escapeChar {
+			if _, ok := s.peek(); !ok {
+				// An escape rune at the end of the document is read as it is.
+				if !s.discard {
+					escaped.WriteRune(s.c)
+				}
+				err = s.next()
+				if err != nil {
+					return "", err
+				}
+				continue
+			}
+			if s.rule.rawQuotes && !s.discard {
+				escaped.WriteRune(s.c)
+			}
+			err = s.next()
+			if err != nil {
+				return "", err
+			}
+			if !s.discard {
+				if s.rule.rawQuotes {
+					escaped.WriteRune(s.c)
+				} else {
+					escaped.WriteRune(unescapeRune(s.c))
+				}
+			}
+			err = s.next()
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
 		if s.isQuote(s.c) {
-			if string(s.c) != leadingQuote {
+			if s.c != leadingQuote {
+				// A literal quote of the other type, or the end of the field.
 				if foundFirstQuote {
-					return escaped, nil
+					return escaped.String(), nil
+				}
+				if !s.discard {
+					escaped.WriteRune(s.c)
 				}
-				escaped += string(s.c)
 				err = s.next()
 				if err != nil {
 					return "", err
@@ -283,13 +1239,18 @@ func (s *Scanner) scanEscaped() (string, error) {
 			// s.c == leading quote, escape or field end.
 			if !foundFirstQuote {
 				foundFirstQuote = true
+				if s.rule.rawQuotes && !s.discard {
+					escaped.WriteRune(s.c)
+				}
 				err = s.next()
 				if err != nil {
 					return "", err
 				}
 			} else {
 				foundFirstQuote = false
-				escaped += string(s.c)
+				if !s.discard {
+					escaped.WriteRune(s.c)
+				}
 				err = s.next()
 				if err != nil {
 					return "", err
@@ -297,9 +1258,17 @@ func (s *Scanner) scanEscaped() (string, error) {
 			}
 		} else {
 			if foundFirstQuote {
-				return escaped, nil
+				return escaped.String(), nil
+			}
+			if !s.discard {
+				if s.crLine && s.pos == len(s.runes)-1 {
+					// A bare \r in a quoted field does not end the record, and
+					// is kept as it is.
+					escaped.WriteRune('\r')
+				} else {
+					escaped.WriteRune(s.c)
+				}
 			}
-			escaped += string(s.c)
 			var err = s.next()
 			if err != nil {
 				return "", err
@@ -308,22 +1277,49 @@ func (s *Scanner) scanEscaped() (string, error) {
 	}
 
 	if foundFirstQuote {
-		return escaped, nil
+		return escaped.String(), nil
 	}
 	return "", fmt.Errorf("trailing quote not found")
 }
 
+// unescapeRune returns the rune which c stands for after an escape rune.
+func unescapeRune(c rune) rune {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+	return c
+}
+
 func (s *Scanner) scanNonEscaped() (string, error) {
-	if (s.isComma(s.c) || s.isLineEnd(s.c) || s.eof) && !s.rule.allowEmptyField {
+	if (s.isComma(0) || s.isLineEnd(s.c) || s.isTrailingComment(s.c) || s.eof) && !s.rule.allowEmptyField {
 		return "", fmt.Errorf("unexpected empty field, expect text")
 	}
 	if s.isQuote(s.c) {
 		return "", fmt.Errorf("unexpected character '%s', expect text", string(s.c))
 	}
 
-	var nonEscaped string
-	for !s.eof && !s.isLineEnd(s.c) && !s.isComma(s.c) && (s.rule.suffix == noRune || s.c != s.rule.suffix) {
-		nonEscaped += string(s.c)
+	var nonEscaped strings.Builder
+	for !s.eof && !s.isLineEnd(s.c) && !s.isComma(0) && !s.isTrailingComment(s.c) && (s.rule.suffix == noRune || s.c != s.rule.suffix) {
+		if s.rule.escapedSeparator && s.c == '\\' {
+			// A backslash before a separator makes it a part of the field.
+			if s.isComma(1) {
+				var err = s.next()
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+		if s.rule.trailingQuote == TrailingQuoteError && s.isQuote(s.c) && s.isFieldEnd() {
+			return "", fmt.Errorf("unexpected character '%s' at the end of an unquoted field", string(s.c))
+		}
+		if !s.discard {
+			nonEscaped.WriteRune(s.c)
+		}
 		var err = s.next()
 		if err != nil {
 			return "", err
@@ -332,29 +1328,32 @@ func (s *Scanner) scanNonEscaped() (string, error) {
 
 	// Suffix.
 	if s.rule.suffix != noRune {
-		if s.c != s.rule.suffix {
+		if s.c == s.rule.suffix {
+			var err = s.next()
+			if err != nil {
+				return "", err
+			}
+		} else if !s.rule.optionalAffix {
 			return "", fmt.Errorf("suffix not found")
 		}
-		var err = s.next()
-		if err != nil {
-			return "", err
-		}
 	}
-	return nonEscaped, nil
+	return nonEscaped.String(), nil
 }
 
-// scanCOMMA scans a separator. A separator is a comma, or other rune as set
-// with the Separator() setting.
+// scanCOMMA scans a separator. A separator is a comma, or other runes as set
+// with the Separator() or SeparatorString() setting.
 //
 // If no separator is found, an error will be returned.
 func (s *Scanner) scanCOMMA() (string, error) {
-	if s.c != s.rule.separator {
-		return "", fmt.Errorf("unexpected character '%s', expect %s", string(s.c), string(s.rule.separator))
+	var comma = s.rule.separatorText()
+	if !s.isComma(0) {
+		return "", fmt.Errorf("unexpected character '%s', expect %s", string(s.c), comma)
 	}
-	var comma = string(s.c)
-	var err = s.next()
-	if err != nil {
-		return "", err
+	for range comma {
+		var err = s.next()
+		if err != nil {
+			return "", err
+		}
 	}
 	return comma, nil
 }
@@ -388,19 +1387,44 @@ func (s *Scanner) scanQUOTE() (string, error) {
 
 // scanSPACE scans while the current rune is a space.
 func (s *Scanner) scanSPACE() (string, error) {
-	var spaces string
+	var spaces strings.Builder
 	for !s.eof && s.isSpace(s.c) {
-		spaces += string(s.c)
+		spaces.WriteRune(s.c)
 		var err = s.next()
 		if err != nil {
 			return "", err
 		}
 	}
-	return spaces, nil
+	return spaces.String(), nil
+}
+
+// isFieldEnd reports whether the current rune is the last one of an unquoted
+// field, i.e. it is followed by a separator, a suffix, a line end or the end of
+// the document.
+func (s *Scanner) isFieldEnd() bool {
+	c, ok := s.peek()
+	return !ok || s.isComma(1) || s.isLineEnd(c) || (s.rule.suffix != noRune && c == s.rule.suffix)
+}
+
+// isTrailingSeparator reports whether the current rune is a separator followed
+// by nothing but omitted spaces and the line end.
+func (s *Scanner) isTrailingSeparator() bool {
+	var end = s.pos + utf8.RuneCountInString(s.rule.separatorText())
+	if end > len(s.runes) {
+		// The rest of the line is shorter than the separator.
+		return false
+	}
+	var omitSpace = s.rule.omitLeadingSpace || s.rule.omitTrailingSpace
+	for _, c := range s.runes[end:] {
+		if !(omitSpace && s.isSpace(c)) && c != '\r' && !s.isLineEnd(c) {
+			return false
+		}
+	}
+	return true
 }
 
 func (s *Scanner) isQuote(c rune) bool {
-	if c == '"' {
+	if c == s.rule.quote {
 		return true
 	}
 	if s.rule.allowSingleQuote && c == '\'' {
@@ -409,15 +1433,41 @@ func (s *Scanner) isQuote(c rune) bool {
 	return false
 }
 
+// isTrailingComment reports whether c starts a comment after the fields of a
+// record, as set with the TrailingComment setting.
+func (s *Scanner) isTrailingComment(c rune) bool {
+	return s.rule.trailingComment && s.rule.comment != noRune && c == s.rule.comment
+}
+
 func (s *Scanner) isLineEnd(c rune) bool {
 	return c == '\n'
 }
 
-func (s *Scanner) isComma(c rune) bool {
-	return c == s.rule.separator
+// isComma reports whether the separator starts at the rune offset runes after
+// the current one.
+func (s *Scanner) isComma(offset int) bool {
+	var i = s.pos + offset
+	if s.rule.separatorString == "" {
+		return i < len(s.runes) && s.runes[i] == s.rule.separator
+	}
+	for _, c := range s.rule.separatorString {
+		if i >= len(s.runes) || s.runes[i] != c {
+			return false
+		}
+		i++
+	}
+	return true
 }
 
+// isSpace reports whether c is a space. c is a decoded rune, so 0x85 and 0xA0
+// are U+0085 (NEL) and U+00A0 (NBSP) regardless of the document encoding.
+//
+// The separator is never a space, so that a tab separator is not omitted as a
+// leading or trailing space.
 func (s *Scanner) isSpace(c rune) bool {
+	if c == s.rule.separator || (s.rule.separatorString != "" && strings.ContainsRune(s.rule.separatorString, c)) {
+		return false
+	}
 	switch c {
 	case '\t', '\v', '\f', ' ', 0x85, 0xA0:
 		return true
@@ -425,15 +1475,42 @@ func (s *Scanner) isSpace(c rune) bool {
 	return false
 }
 
-// Ignores the BOM (byte order mark) at the beginning of document, and set pos
-// to the last byte of
-func (s *Scanner) ignoreBOM() error {
-	b, err := s.f.Peek(3)
-	if err != nil {
-		return err
+// isValidUTF8 reports whether field is valid UTF-8 without any U+FFFD, which
+// invalid bytes are decoded to.
+func isValidUTF8(field string) bool {
+	return utf8.ValidString(field) && !strings.ContainsRune(field, utf8.RuneError)
+}
+
+// skipRawBOM skips the UTF-8 BOM at the beginning of the undecoded document
+// read from r, if there is one.
+func skipRawBOM(r io.Reader) io.Reader {
+	var br = bufio.NewReader(r)
+	b, err := br.Peek(3)
+	if err == nil && b[0] == bom0 && b[1] == bom1 && b[2] == bom2 {
+		br.Discard(3)
 	}
-	if b[0] == bom0 && b[1] == bom1 && b[2] == bom2 {
-		return s.next()
+	return br
+}
+
+// skipBlankDocument returns an empty reader if r contains only spaces and line
+// breaks. Otherwise, the returned reader reads the same content as r.
+func skipBlankDocument(r io.Reader) (io.Reader, error) {
+	var br = bufio.NewReader(r)
+	var leading []byte
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return bytes.NewReader(nil), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch b {
+		case ' ', '\t', '\v', '\f', '\r', '\n':
+			leading = append(leading, b)
+		default:
+			br.UnreadByte()
+			return io.MultiReader(bytes.NewReader(leading), br), nil
+		}
 	}
-	return nil
 }
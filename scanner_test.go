@@ -6,11 +6,17 @@
 package csv_test
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/beta/csv"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
 )
 
 const csvStandard = `aaa,bbb,ccc
@@ -85,6 +91,10 @@ const csvWithBOM = "\xEF\xBB\xBF" + `aaa,bbb,ccc
 aaa,"b
 bb","ccc"`
 
+// "café,it’s, déjà vu " and "naïve,x" in Windows-1252, with NBSPs around
+// "déjà vu".
+const csvWindows1252 = "caf\xe9,it\x92s,\xa0d\xe9j\xe0 vu\xa0\nna\xefve,x"
+
 func TestScanner(t *testing.T) {
 	s, err := csv.NewScanner([]byte(csvStandard))
 	if err != nil {
@@ -102,6 +112,55 @@ func TestScanner(t *testing.T) {
 	}
 }
 
+func TestScannerAtEOF(t *testing.T) {
+	for _, data := range []string{"a,b,c\nd,e,f", "a,b,c\nd,e,f\n"} {
+		s, err := csv.NewScanner([]byte(data))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, expected := range []string{"a", "d"} {
+			if s.AtEOF() {
+				t.Errorf("scanner of %q reaches the end before row %q", data, expected)
+				return
+			}
+			row, err := s.Scan()
+			if err != nil {
+				t.Errorf("failed to scan row %q of %q: %v", expected, data, err)
+				return
+			}
+			if len(row) != 3 || row[0] != expected {
+				t.Errorf("row of %q is wrong, expect %q, get %q", data, expected, row)
+				return
+			}
+		}
+		if !s.AtEOF() {
+			t.Errorf("scanner of %q does not reach the end after the last row", data)
+			return
+		}
+		row, err := s.Scan()
+		if row != nil || err != io.EOF {
+			t.Errorf("scanner of %q returns (%q, %v) after the last row, expect io.EOF", data, row, err)
+			return
+		}
+	}
+}
+
+func TestScannerWithEmptyDocument(t *testing.T) {
+	for _, data := range []string{"", "\n", "\n\n", "   ", " \t\n  \n"} {
+		s, err := csv.NewScanner([]byte(data))
+		if err != nil {
+			t.Errorf("failed to create scanner of %q: %v", data, err)
+			return
+		}
+		row, err := s.Scan()
+		if row != nil || err != io.EOF {
+			t.Errorf("scanner of %q returns (%q, %v), expect io.EOF", data, row, err)
+			return
+		}
+	}
+}
+
 func TestScannerScanAll(t *testing.T) {
 	s, err := csv.NewScanner([]byte(csvStandard))
 	if err != nil {
@@ -144,28 +203,101 @@ func TestScannerEscaped(t *testing.T) {
 	printRows(t, rows)
 }
 
-func TestScannerWithHeader(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithHeader))
+func TestScannerWithRawQuotes(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvEscaped), csv.RawQuotes(true))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	header, err := s.Scan()
+	rows, err := s.ScanAll()
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	printHeader(t, header)
-	rows, err := s.ScanAll()
+	if rows[1][0] != `"aa""a"` || rows[1][1] != "bbb" || rows[2][1] != "\"b\"\"\nb\"\"b\"" {
+		t.Errorf("quotes are not kept")
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerScanInto(t *testing.T) {
+	const data = `a0,a1,"a
+2",a3,a4,a5
+b0,"b,1",b2,b3,b4,b5`
+	s, err := csv.NewScanner([]byte(data))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	printRows(t, rows)
+	for _, expected := range [][]string{{"a5", "a1"}, {"b5", "b,1"}} {
+		fields, err := s.ScanInto([]int{5, 1})
+		if err != nil && err != io.EOF {
+			t.Error(err)
+			return
+		}
+		if len(fields) != 2 || fields[0] != expected[0] || fields[1] != expected[1] {
+			t.Errorf("fields are wrong, expect %q, get %q", expected, fields)
+			return
+		}
+	}
+
+	// Missing columns.
+	s, err = csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanInto([]int{6})
+	if err == nil {
+		t.Errorf("missing column is not reported")
+		return
+	}
+	s, err = csv.NewScanner([]byte(data), csv.AllowMissingColumns(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fields, err := s.ScanInto([]int{6, 0})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fields[0] != "" || fields[1] != "a0" {
+		t.Errorf("fields are wrong, get %q", fields)
+	}
 }
 
-func TestScannerWithCustomSeparator(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithCustomSeparator), csv.Separator('|'))
+func TestScannerDistinctColumn(t *testing.T) {
+	const data = `aaa,x,1
+bbb,"y
+y",2
+ccc,x,3
+ddd,"y
+y",4`
+	s, err := csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	values, err := s.DistinctColumn(1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(values) != 2 {
+		t.Errorf("distinct value count is wrong, expect %d, get %d", 2, len(values))
+		return
+	}
+	for _, value := range []string{"x", "y\ny"} {
+		if _, exist := values[value]; !exist {
+			t.Errorf("value %q is not found", value)
+		}
+	}
+}
+
+func TestScannerWithHeader(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithHeader))
 	if err != nil {
 		t.Error(err)
 		return
@@ -184,79 +316,124 @@ func TestScannerWithCustomSeparator(t *testing.T) {
 	printRows(t, rows)
 }
 
-func TestScannerWithSingleQuote(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithSingleQuote),
-		csv.AllowSingleQuote(true))
+func TestScannerScanAllWithHeader(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithHeader))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	rows, err := s.ScanAll()
+	header, rows, err := s.ScanAllWithHeader()
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	if len(header) != 3 || header[0] != "Col A" || header[2] != "Col\nC" {
+		t.Errorf("header is wrong, get %q", header)
+		return
+	}
+	if len(rows) != 3 || rows[0][0] != "aaa" {
+		t.Errorf("rows are wrong, get %q", rows)
+		return
+	}
+	printHeader(t, header)
 	printRows(t, rows)
-}
 
-func TestScannerWithComment(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithComment), csv.Comment('#'))
+	// Without the Header setting, the first row is data.
+	s, err = csv.NewScanner([]byte(csvWithHeader), csv.Header(false))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	rows, err := s.ScanAll()
+	header, rows, err = s.ScanAllWithHeader()
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	printRows(t, rows)
-}
+	if header != nil || len(rows) != 4 || rows[0][0] != "Col A" {
+		t.Errorf("header or rows are wrong, get %q and %q", header, rows)
+		return
+	}
 
-func TestScannerWithSpace(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithSpace),
-		csv.OmitLeadingSpace(true), csv.OmitTrailingSpace(true))
+	// With HeaderNames, the given names are the header.
+	s, err = csv.NewScanner([]byte(csvWithHeader), csv.Header(false), csv.HeaderNames([]string{"a", "b", "c"}))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	rows, err := s.ScanAll()
+	header, rows, err = s.ScanAllWithHeader()
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	printRows(t, rows)
+	if len(header) != 3 || header[0] != "a" || len(rows) != 4 {
+		t.Errorf("header or rows are wrong, get %q and %q", header, rows)
+	}
 }
 
-func TestScannerWithEmptyField(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithEmptyField), csv.AllowEmptyField(true))
+func TestScannerScanHeader(t *testing.T) {
+	const data = `# Exported data.
+
+name,age
+Alice,20
+Bob,30`
+	s, err := csv.NewScanner([]byte(data), csv.Comment('#'))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	rows, err := s.ScanAll()
+	header, err := s.ScanHeader()
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	printRows(t, rows)
-}
-func TestScannerWithPrefixAndSuffix(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithPrefixAndSuffix))
+	if len(header) != 2 || header[0] != "name" || header[1] != "age" {
+		t.Errorf("header is wrong, get %q", header)
+		return
+	}
+	row, err := s.Scan()
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	if len(row) != 2 || row[0] != "Alice" {
+		t.Errorf("first data row is wrong, get %q", row)
+		return
+	}
 
-	s.Setting(csv.Prefix('['), csv.Suffix(']'))
+	// The header is not scanned again.
+	header, rows, err := s.ScanAllWithHeader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(header) != 2 || header[0] != "name" || len(rows) != 1 || rows[0][0] != "Bob" {
+		t.Errorf("header or rows are wrong, get %q and %q", header, rows)
+		return
+	}
+
+	s, err = csv.NewScanner(nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanHeader()
+	if err != io.EOF {
+		t.Errorf("expect io.EOF for an empty document, get %v", err)
+	}
+}
+
+func TestScannerWithCustomSeparator(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithCustomSeparator), csv.Separator('|'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
 	header, err := s.Scan()
 	if err != nil {
 		t.Error(err)
 		return
 	}
 	printHeader(t, header)
-
-	s.Setting(csv.Prefix('('), csv.Suffix(')'))
 	rows, err := s.ScanAll()
 	if err != nil {
 		t.Error(err)
@@ -265,8 +442,9 @@ func TestScannerWithPrefixAndSuffix(t *testing.T) {
 	printRows(t, rows)
 }
 
-func TestScannerWithEmptyLines(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithEmptyLines), csv.OmitEmptyLine(true))
+func TestScannerWithSingleQuote(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithSingleQuote),
+		csv.AllowSingleQuote(true))
 	if err != nil {
 		t.Error(err)
 		return
@@ -276,14 +454,114 @@ func TestScannerWithEmptyLines(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if len(rows) != 3 {
-		t.Errorf("row count is wrong, expect %d, get %d", 3, len(rows))
-	}
 	printRows(t, rows)
 }
 
-func TestScannerWithEndingLineBreakInLastRecord(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithEndingLineBreakInLastRecord), csv.AllowEndingLineBreakInLastRecord(true))
+func TestScannerWithMixedQuotes(t *testing.T) {
+	var cases = []struct {
+		data     string
+		expected []string
+	}{
+		{`'a""b',"a''b"`, []string{`a""b`, `a''b`}},
+		{`'it''s',"say ""hi"""`, []string{`it's`, `say "hi"`}},
+		{`'"',"'"`, []string{`"`, `'`}},
+		{`'a''""''b'`, []string{`a'""'b`}},
+		{`"''''",'""""'`, []string{`''''`, `""""`}},
+	}
+	for _, c := range cases {
+		s, err := csv.NewScanner([]byte(c.data), csv.AllowSingleQuote(true))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		row, err := s.Scan()
+		if err != nil {
+			t.Errorf("cannot scan %s: %v", c.data, err)
+			return
+		}
+		if !reflect.DeepEqual(row, c.expected) {
+			t.Errorf("fields of %s are wrong, expect %q, get %q", c.data, c.expected, row)
+			return
+		}
+	}
+
+	// A quote of the other type cannot follow the closing quote.
+	for _, data := range []string{`'a'"b"`, `"a"'b'`} {
+		s, err := csv.NewScanner([]byte(data), csv.AllowSingleQuote(true))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.Scan()
+		if err == nil {
+			t.Errorf("invalid field %s is not reported", data)
+			return
+		}
+	}
+}
+
+func TestScannerWithEscapeChar(t *testing.T) {
+	var cases = []struct {
+		data     string
+		expected []string
+	}{
+		{`"he said \"hi\"",b`, []string{`he said "hi"`, "b"}},
+		{`"C:\\dir\\",b`, []string{`C:\dir\`, "b"}},
+		{`"a\nb\tc",d\e`, []string{"a\nb\tc", `d\e`}},
+		{`"say ""hi""",\`, []string{`say "hi"`, `\`}},
+		{`"a\,b"`, []string{"a,b"}},
+	}
+	for _, c := range cases {
+		s, err := csv.NewScanner([]byte(c.data), csv.EscapeChar('\\'))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		row, err := s.Scan()
+		if err != nil {
+			t.Errorf("cannot scan %s: %v", c.data, err)
+			return
+		}
+		if !reflect.DeepEqual(row, c.expected) {
+			t.Errorf("fields of %s are wrong, expect %q, get %q", c.data, c.expected, row)
+			return
+		}
+	}
+
+	// An escaped closing quote leaves the field unterminated.
+	s, err := csv.NewScanner([]byte(`"abc\"`), csv.EscapeChar('\\'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.Scan()
+	if err == nil {
+		t.Error("unterminated field is not reported")
+		return
+	}
+
+	// Fields are written with escapes and read back.
+	var original = [][]string{
+		{`he said "hi"`, `C:\dir\`},
+		{"a,b", `\"`},
+	}
+	var g = csv.NewGenerator(csv.EscapeChar('\\'))
+	err = g.WriteAll(original)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	const expected = `"he said \"hi\"",C:\dir\` + "\n" + `"a,b","\\\""`
+	if string(data) != expected {
+		t.Errorf("output is wrong, expect %q, get %q", expected, string(data))
+		return
+	}
+	s, err = csv.NewScanner(data, csv.EscapeChar('\\'))
 	if err != nil {
 		t.Error(err)
 		return
@@ -293,44 +571,1324 @@ func TestScannerWithEndingLineBreakInLastRecord(t *testing.T) {
 		t.Error(err)
 		return
 	}
-	if len(rows) != 3 {
-		t.Errorf("row count is wrong, expect %d, get %d", 3, len(rows))
+	if !reflect.DeepEqual(rows, original) {
+		t.Errorf("rows are not read back, expect %q, get %q", original, rows)
+		return
 	}
-	printRows(t, rows)
 }
 
-func TestScannerWithBOM(t *testing.T) {
-	s, err := csv.NewScanner([]byte(csvWithBOM), csv.IgnoreBOM(true))
+func TestScannerLineAndPosition(t *testing.T) {
+	s, err := csv.NewScanner([]byte("a,b\n# comment\nc,\"d\ne\"\nf,\"g\"h"), csv.Comment('#'))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	rows, err := s.ScanAll()
+	var expected = []int{3, 5}
+	for _, line := range expected {
+		_, err = s.Scan()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if s.Line() != line || s.Position() != 0 {
+			t.Errorf("expect line %d, pos 0, get line %d, pos %d", line, s.Line(), s.Position())
+			return
+		}
+	}
+
+	_, err = s.Scan()
+	if err == nil {
+		t.Errorf("invalid field is not reported")
+		return
+	}
+	if s.Line() != 5 || s.Position() != 5 {
+		t.Errorf("expect line 5, pos 5, get line %d, pos %d", s.Line(), s.Position())
+		return
+	}
+	t.Log(err)
+}
+
+func TestScannerFieldsPerRecord(t *testing.T) {
+	const data = "a,b,c\n1,2,3\n4,5\n6,7,8,9"
+	var cases = []struct {
+		n       int
+		errLine int // Line of the error, 0 if no error.
+	}{
+		{-1, 0},
+		{0, 3},
+		{3, 3},
+		{2, 1},
+	}
+	for _, c := range cases {
+		s, err := csv.NewScanner([]byte(data), csv.FieldsPerRecord(c.n))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.ScanAll()
+		if c.errLine == 0 {
+			if err != nil {
+				t.Errorf("records with any number of fields are not allowed with FieldsPerRecord(%d): %v", c.n, err)
+				return
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("line %d,", c.errLine)) {
+			t.Errorf("wrong number of fields is not reported at line %d with FieldsPerRecord(%d), get %v", c.errLine, c.n, err)
+			return
+		}
+	}
+
+	// The number of fields is not checked by default.
+	s, err := csv.NewScanner([]byte(data))
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	if rows[0][0] != "aaa" {
-		t.Errorf("BOM is not ignored")
+	_, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
 		return
 	}
-	printRows(t, rows)
-}
 
-func printHeader(t *testing.T, header []string) {
-	if len(header) > 0 {
-		t.Logf("Header: [%s]\n", strings.Join(header, ", "))
+	// The first record sets the number for all the chunks.
+	s, err = csv.NewScanner([]byte(strings.Repeat("1,2\n", 100)+"3,4,5\n"+strings.Repeat("6,7\n", 100)), csv.FieldsPerRecord(0))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ParallelScanAll(4)
+	if err == nil || !strings.Contains(err.Error(), "line 101,") {
+		t.Errorf("wrong number of fields is not reported at line 101, get %v", err)
+		return
 	}
+	t.Log(err)
 }
 
-func printRow(t *testing.T, row []string) {
-	if len(row) > 0 {
-		t.Logf("Row: [%s]\n", strings.Join(row, ", "))
+func TestScannerScanFunc(t *testing.T) {
+	var errStop = errors.New("stop")
+	s, err := csv.NewScanner([]byte("a,b\nc,d\nSTOP\ne,f"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var rows [][]string
+	err = s.ScanFunc(func(row []string) error {
+		if row[0] == "STOP" {
+			return errStop
+		}
+		rows = append(rows, row)
+		return nil
+	})
+	if err != errStop {
+		t.Errorf("error of the callback is not returned, get %v", err)
+		return
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"a", "b"}, {"c", "d"}}) {
+		t.Errorf("rows before the sentinel are wrong, get %q", rows)
+		return
+	}
+
+	// The rest rows can still be scanned.
+	var count int
+	err = s.ScanFunc(func(row []string) error {
+		count++
+		return nil
+	})
+	if err != nil || count != 1 {
+		t.Errorf("expect 1 more row and no error, get %d rows and error %v", count, err)
 	}
 }
 
-func printRows(t *testing.T, rows [][]string) {
-	for i, row := range rows {
-		t.Logf("Row #%d: [%s]\n", i, strings.Join(row, ", "))
+func TestScannerRows(t *testing.T) {
+	s, err := csv.NewScanner([]byte("a,b\nc,d\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var rows [][]string
+	for row, err := range s.Rows() {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows = append(rows, row)
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"a", "b"}, {"c", "d"}}) {
+		t.Errorf("rows are wrong, get %q", rows)
+		return
+	}
+
+	s, err = csv.NewScanner([]byte("a,b\n\"c,d\ne,f"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var count, errCount int
+	for row, err := range s.Rows() {
+		if err != nil {
+			errCount++
+			continue
+		}
+		if row == nil {
+			t.Errorf("nil row is yielded without an error")
+		}
+		count++
+	}
+	if count != 1 || errCount != 1 {
+		t.Errorf("expect 1 row and 1 error, get %d rows and %d errors", count, errCount)
+	}
+}
+
+func TestScannerReuseRecord(t *testing.T) {
+	const data = "a,b,c\n1,2,3\nx,y,z\n"
+	s, err := csv.NewScanner([]byte(data), csv.ReuseRecord(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	first, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var fields = append([]string(nil), first...)
+	second, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(second, []string{"1", "2", "3"}) {
+		t.Errorf("row is wrong, get %q", second)
+		return
+	}
+	if &first[0] != &second[0] {
+		t.Error("the record is not reused")
+		return
+	}
+	if !reflect.DeepEqual(fields, []string{"a", "b", "c"}) {
+		t.Errorf("copied fields are changed, get %q", fields)
+		return
+	}
+
+	// ScanAll always returns separate rows.
+	s, err = csv.NewScanner([]byte(data), csv.ReuseRecord(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = [][]string{{"a", "b", "c"}, {"1", "2", "3"}, {"x", "y", "z"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("rows are wrong, expect %q, get %q", expected, rows)
+		return
+	}
+}
+
+func TestScannerWithComment(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithComment), csv.Comment('#'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithTrailingComment(t *testing.T) {
+	const data = "# full-line comment\n" +
+		"a,b,c # note\n" +
+		"\"x # y\",z#note\n" +
+		"1,\"2#\"# \"quoted\" note\n" +
+		"e,# empty\n"
+	var expected = [][]string{
+		{"a", "b", "c"},
+		{"x # y", "z"},
+		{"1", "2#"},
+		{"e", ""},
+	}
+	s, err := csv.NewScanner([]byte(data), csv.Comment('#'), csv.TrailingComment(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("rows are wrong, expect %q, get %q", expected, rows)
+		return
+	}
+
+	// The comment rune is a part of an unquoted field without TrailingComment.
+	s, err = csv.NewScanner([]byte("a,b # note"), csv.Comment('#'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(row, []string{"a", "b # note"}) {
+		t.Errorf("row is wrong, get %q", row)
+		return
+	}
+
+	// Fields containing the comment rune are quoted while writing.
+	var g = csv.NewGenerator(csv.Comment('#'), csv.TrailingComment(true))
+	err = g.Write([]string{"a#b", "c"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	output, err := g.Finish()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(output) != `"a#b",c` {
+		t.Errorf("output is wrong, get %q", string(output))
+		return
+	}
+}
+
+func TestScannerSkipRows(t *testing.T) {
+	const data = "Sales report\n" +
+		"\n" +
+		"# Exported at 2018-06-01\n" +
+		"name,qty\n" +
+		"apple,3\n" +
+		"pear,5\n"
+	s, err := csv.NewScanner([]byte(data), csv.SkipRows(2), csv.Comment('#'), csv.Header(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header, err := s.ScanHeader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(header, []string{"name", "qty"}) {
+		t.Errorf("header is wrong, get %q", header)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = [][]string{{"apple", "3"}, {"pear", "5"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("rows are wrong, expect %q, get %q", expected, rows)
+		return
+	}
+
+	// Skipped lines are counted in line numbers.
+	s, err = csv.NewScanner([]byte("title\nname,qty\n\"apple,3\n"), csv.SkipRows(1))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("error should be reported at line 3, get %v", err)
+		return
+	}
+
+	// All the lines may be skipped.
+	s, err = csv.NewScanner([]byte("a\nb"), csv.SkipRows(5))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 0 {
+		t.Errorf("no rows should be scanned, get %q", rows)
+		return
+	}
+
+	_, err = csv.NewScanner([]byte(data), csv.SkipRows(-1))
+	if err == nil {
+		t.Error("negative number of rows to skip is not reported")
+		return
+	}
+}
+
+func TestScannerWithSpace(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithSpace),
+		csv.OmitLeadingSpace(true), csv.OmitTrailingSpace(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithEmptyField(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithEmptyField), csv.AllowEmptyField(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithLeadingAndTrailingEmptyFields(t *testing.T) {
+	var cases = []struct {
+		data     string
+		expected []string
+	}{
+		{"a,b,", []string{"a", "b", ""}},
+		{"a,b,\n", []string{"a", "b", ""}},
+		{"a,,b", []string{"a", "", "b"}},
+		{",a", []string{"", "a"}},
+		{",", []string{"", ""}},
+		{`"",`, []string{"", ""}}, // The trailing field is empty.
+	}
+	for _, c := range cases {
+		s, err := csv.NewScanner([]byte(c.data))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		row, err := s.Scan()
+		if err != nil {
+			t.Errorf("failed to scan %q: %v", c.data, err)
+			return
+		}
+		if len(row) != len(c.expected) {
+			t.Errorf("fields of %q are wrong, expect %q, get %q", c.data, c.expected, row)
+			return
+		}
+		for i := range row {
+			if row[i] != c.expected[i] {
+				t.Errorf("fields of %q are wrong, expect %q, get %q", c.data, c.expected, row)
+				return
+			}
+		}
+
+		// Without AllowEmptyField, an error is returned at the line of the
+		// empty field instead of dropping it.
+		s, err = csv.NewScanner([]byte(c.data), csv.AllowEmptyField(false))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.Scan()
+		if err == nil || !strings.Contains(err.Error(), "line 1,") {
+			t.Errorf("expect an error of empty field at line 1 while scanning %q, get %v", c.data, err)
+			return
+		}
+	}
+}
+
+func TestScannerWithPrefixAndSuffix(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithPrefixAndSuffix))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	s.Setting(csv.Prefix('['), csv.Suffix(']'))
+	header, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printHeader(t, header)
+
+	s.Setting(csv.Prefix('('), csv.Suffix(')'))
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithOptionalAffix(t *testing.T) {
+	const data = `(aaa),bbb,("ccc")
+ddd,(eee),"fff"`
+	s, err := csv.NewScanner([]byte(data), csv.Prefix('('), csv.Suffix(')'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err == nil {
+		t.Errorf("missing prefix is not reported")
+		return
+	}
+
+	s, err = csv.NewScanner([]byte(data), csv.Prefix('('), csv.Suffix(')'), csv.OptionalAffix(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if strings.Join(rows[0], "|") != "aaa|bbb|ccc" || strings.Join(rows[1], "|") != "ddd|eee|fff" {
+		t.Errorf("rows are wrong, get %q", rows)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithEmptyLines(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithEmptyLines), csv.OmitEmptyLine(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 3 {
+		t.Errorf("row count is wrong, expect %d, get %d", 3, len(rows))
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithEndingLineBreakInLastRecord(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithEndingLineBreakInLastRecord), csv.AllowEndingLineBreakInLastRecord(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 3 {
+		t.Errorf("row count is wrong, expect %d, get %d", 3, len(rows))
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithBOM(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvWithBOM), csv.IgnoreBOM(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if rows[0][0] != "aaa" {
+		t.Errorf("BOM is not ignored")
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerCountRecords(t *testing.T) {
+	s, err := csv.NewScanner([]byte(csvStandard))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	count, err := s.CountRecords()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	s, err = csv.NewScanner([]byte(csvStandard))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if count != len(rows) {
+		t.Errorf("record count is wrong, expect %d, get %d", len(rows), count)
+	}
+}
+
+func TestScannerWithProgress(t *testing.T) {
+	var calls = make([]int, 0)
+	s, err := csv.NewScanner([]byte(csvWithEmptyLines),
+		csv.Progress(2, func(records int) { calls = append(calls, records) }))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(calls) != 1 || calls[0] != 2 {
+		t.Errorf("progress is reported wrongly, get %v", calls)
+	}
+}
+
+func TestScannerWithNUL(t *testing.T) {
+	const data = "a\x00a,\x00,(\x00)\n\"\x00\",b\x00,\x00c"
+	var expected = [][]string{{"a\x00a", "\x00", "(\x00)"}, {"\x00", "b\x00", "\x00c"}}
+	s, err := csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != len(expected) {
+		t.Errorf("row count is wrong, expect %d, get %d", len(expected), len(rows))
+		return
+	}
+	for i := range expected {
+		if strings.Join(rows[i], ",") != strings.Join(expected[i], ",") {
+			t.Errorf("row %d is wrong, expect %q, get %q", i, expected[i], rows[i])
+		}
+	}
+
+	// NUL in fields with prefix and suffix.
+	s, err = csv.NewScanner([]byte("(\x00),(a\x00)"), csv.Prefix('('), csv.Suffix(')'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if rows[0][0] != "\x00" || rows[0][1] != "a\x00" {
+		t.Errorf("fields with prefix and suffix are wrong, get %q", rows[0])
+	}
+}
+
+func TestScannerWithWindows1252(t *testing.T) {
+	for _, data := range []string{csvWindows1252, "\xEF\xBB\xBF" + csvWindows1252} {
+		s, err := csv.NewScanner([]byte(data), csv.Encoding(charmap.Windows1252))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows, err := s.ScanAll()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if rows[0][0] != "café" || rows[0][1] != "it’s" || rows[0][2] != "déjà vu" || rows[1][0] != "naïve" {
+			t.Errorf("document is not decoded correctly, get %q", rows)
+			return
+		}
+		printRows(t, rows)
+	}
+}
+
+func TestScannerDetectedLineEnding(t *testing.T) {
+	var cases = []struct {
+		data     string
+		expected string
+	}{
+		{"aaa,bbb\nccc,ddd\n", csv.LineEndingLF},
+		{"aaa,bbb\r\nccc,ddd\r\n", csv.LineEndingCRLF},
+		{"aaa,bbb\r\nccc,ddd\n", csv.LineEndingMixed},
+		{"aaa,bbb", ""},
+		{"a\rb,c\nd,e\n", csv.LineEndingLF},
+		{"\"a\rb\r\",c\nd,e\n", csv.LineEndingLF},
+	}
+	for _, c := range cases {
+		s, err := csv.NewScanner([]byte(c.data))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.ScanAll()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if s.DetectedLineEnding() != c.expected {
+			t.Errorf("line ending of %q is wrong, expect %q, get %q", c.data, c.expected, s.DetectedLineEnding())
+		}
+	}
+}
+
+func printHeader(t *testing.T, header []string) {
+	if len(header) > 0 {
+		t.Logf("Header: [%s]\n", strings.Join(header, ", "))
+	}
+}
+
+func printRow(t *testing.T, row []string) {
+	if len(row) > 0 {
+		t.Logf("Row: [%s]\n", strings.Join(row, ", "))
+	}
+}
+
+func printRows(t *testing.T, rows [][]string) {
+	for i, row := range rows {
+		t.Logf("Row #%d: [%s]\n", i, strings.Join(row, ", "))
+	}
+}
+
+func TestScannerWithRequireValidUTF8(t *testing.T) {
+	// A Windows-1252 document read as UTF-8.
+	s, err := csv.NewScanner([]byte(csvWindows1252), csv.RequireValidUTF8(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("invalid UTF-8 is not reported with its line, get error %v", err)
+		return
+	}
+	t.Log(err)
+
+	s, err = csv.NewScanner([]byte(csvWindows1252), csv.Encoding(charmap.Windows1252), csv.RequireValidUTF8(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScannerWithFieldTransform(t *testing.T) {
+	// "café" with a combining acute accent.
+	const data = "name,city\ncafe\u0301,paris"
+	s, err := csv.NewScanner([]byte(data), csv.FieldTransform(func(col int, field string) string {
+		field = norm.NFC.String(field)
+		if col == 1 {
+			field = strings.ToUpper(field)
+		}
+		return field
+	}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header, rows, err := s.ScanAllWithHeader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if header[1] != "city" {
+		t.Errorf("header is transformed, get %q", header)
+		return
+	}
+	if len(rows) != 1 || rows[0][0] != "caf\u00e9" || rows[0][1] != "PARIS" {
+		t.Errorf("fields are not transformed, get %q", rows)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerWithParagraphMode(t *testing.T) {
+	const data = `John Smith
+john@example.com
++1 234 567 890
+
+# Comment.
+Mary Jane
+mary@example.com
+`
+	s, err := csv.NewScanner([]byte(data), csv.ParagraphMode(true), csv.Comment('#'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 2 || len(rows[0]) != 3 || rows[0][2] != "+1 234 567 890" ||
+		len(rows[1]) != 2 || rows[1][0] != "Mary Jane" || rows[1][1] != "mary@example.com" {
+		t.Errorf("paragraphs are not scanned as records, get %q", rows)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerScanWithHash(t *testing.T) {
+	const data = `aaa,"b
+bb",ccc
+aaa,bbb,ccc
+aaa,"b
+bb",ccc`
+	s, err := csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var hashes []uint64
+	for {
+		row, hash, err := s.ScanWithHash()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		t.Logf("%q: %x", row, hash)
+		hashes = append(hashes, hash)
+	}
+	if len(hashes) != 3 {
+		t.Errorf("expect 3 rows, get %d", len(hashes))
+		return
+	}
+	if hashes[0] != hashes[2] {
+		t.Errorf("identical rows have different hashes %x and %x", hashes[0], hashes[2])
+	}
+	if hashes[0] == hashes[1] {
+		t.Errorf("different rows have the same hash %x", hashes[0])
+	}
+}
+
+func TestScannerWithConcatenatedBOM(t *testing.T) {
+	const data = "\xEF\xBB\xBFaaa,bbb\n\xEF\xBB\xBFccc,ddd\n"
+	s, err := csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 2 || rows[0][0] != "aaa" || rows[1][0] != "ccc" {
+		t.Errorf("BOMs are not ignored, get %q", rows)
+		return
+	}
+	printRows(t, rows)
+
+	// A BOM in a quoted field is a part of the field.
+	s, err = csv.NewScanner([]byte("\"a\n\ufeffb\",c\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = [][]string{{"a\n\ufeffb", "c"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("rows are wrong, expect %q, get %q", expected, rows)
+		return
+	}
+}
+
+func TestScannerValidate(t *testing.T) {
+	const data = `id,price,in_stock,since
+1,9.99,true,2018-01-02
+two,1e3,false,
+3,,yes,2018-13-01`
+	s, err := csv.NewScanner([]byte(data), csv.ColumnTypes(map[int]csv.ColumnType{
+		0: csv.IntColumn,
+		1: csv.FloatColumn,
+		2: csv.BoolColumn,
+		3: csv.DateColumn,
+	}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.Scan() // Header.
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	invalid, err := s.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(invalid) != 3 {
+		t.Errorf("expect 3 invalid fields, get %v", invalid)
+		return
+	}
+	if invalid[0].Line != 3 || invalid[0].Column != 0 || invalid[0].Field != "two" || invalid[0].Type != csv.IntColumn {
+		t.Errorf("invalid field is wrong, get %+v", invalid[0])
+		return
+	}
+	if invalid[1].Column != 2 || invalid[2].Column != 3 {
+		t.Errorf("invalid fields are wrong, get %v", invalid)
+		return
+	}
+	for _, e := range invalid {
+		t.Log(e)
+	}
+}
+
+func TestScannerWithNormalizeToHeader(t *testing.T) {
+	const data = `a,b,c
+1,2
+1,2,3
+1,2,3,4`
+	s, err := csv.NewScanner([]byte(data), csv.NormalizeToHeader(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, _, err = s.ScanAllWithHeader()
+	if err == nil || !strings.Contains(err.Error(), "data row 3") {
+		t.Errorf("expect an error of the long row, get %v", err)
+		return
+	}
+
+	s, err = csv.NewScanner([]byte(data), csv.NormalizeToHeader(true), csv.TruncateLongRows(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header, rows, err := s.ScanAllWithHeader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 3 {
+		t.Errorf("expect 3 rows, get %q", rows)
+		return
+	}
+	for _, row := range rows {
+		if len(row) != len(header) || row[1] != "2" {
+			t.Errorf("rows are not normalized, get %q", rows)
+			return
+		}
+	}
+	if rows[0][2] != "" || rows[2][2] != "3" {
+		t.Errorf("rows are not normalized, get %q", rows)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerInferTypes(t *testing.T) {
+	const data = `1,1.5,abc,true,2018-01-02,
+2,2,1,false,2018-12-31,
+-3,1e3,x,,,
+4,oops,y,true,2019-02-03,`
+	s, err := csv.NewScanner([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	types, err := s.InferTypes(3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = []csv.ColumnType{csv.IntColumn, csv.FloatColumn, csv.StringColumn, csv.BoolColumn, csv.DateColumn, csv.StringColumn}
+	if len(types) != len(expected) {
+		t.Errorf("types are wrong, expect %v, get %v", expected, types)
+		return
+	}
+	for i := range types {
+		if types[i] != expected[i] {
+			t.Errorf("types are wrong, expect %v, get %v", expected, types)
+			return
+		}
+	}
+
+	// The sampled rows are consumed.
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if row[1] != "oops" {
+		t.Errorf("sampled rows are not consumed, get %q", row)
+	}
+}
+
+func TestScannerWithEmptyLineIsRecord(t *testing.T) {
+	const data = "aaa,bbb\n\nccc,ddd\n"
+	for _, v := range []bool{false, true} {
+		s, err := csv.NewScanner([]byte(data), csv.EmptyLineIsRecord(v), csv.AllowEmptyField(false))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows, err := s.ScanAll()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !v && len(rows) != 2 {
+			t.Errorf("empty line is not omitted, get %q", rows)
+			return
+		}
+		if v && (len(rows) != 3 || len(rows[1]) != 1 || rows[1][0] != "" || rows[2][0] != "ccc") {
+			t.Errorf("empty line is not read as a record, get %q", rows)
+			return
+		}
+		printRows(t, rows)
+	}
+}
+
+// wideLine is a single line of 50k fields.
+var wideLine = []byte(strings.TrimSuffix(strings.Repeat("field,", 50000), ","))
+
+func BenchmarkScannerWideLine(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(wideLine)
+		if err != nil {
+			b.Fatal(err)
+		}
+		row, err := s.Scan()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(row) != 50000 {
+			b.Fatalf("expect 50000 fields, get %d", len(row))
+		}
+	}
+}
+
+// wideQuotedLine is a single line of 50k quoted fields.
+var wideQuotedLine = []byte(strings.TrimSuffix(strings.Repeat(`"fi""eld",`, 50000), ","))
+
+func BenchmarkScannerWideQuotedLine(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(wideQuotedLine)
+		if err != nil {
+			b.Fatal(err)
+		}
+		row, err := s.Scan()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(row) != 50000 {
+			b.Fatalf("expect 50000 fields, get %d", len(row))
+		}
+	}
+}
+
+func BenchmarkScannerScan(b *testing.B) {
+	benchmarkScannerScan(b)
+}
+
+func BenchmarkScannerScanReuseRecord(b *testing.B) {
+	benchmarkScannerScan(b, csv.ReuseRecord(true))
+}
+
+func benchmarkScannerScan(b *testing.B, settings ...csv.Setting) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(bulkCSV, settings...)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for {
+			_, err = s.Scan()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// largeCSV is a synthetic document of about 10 MB, with quoted, escaped and
+// long fields.
+var largeCSV = func() []byte {
+	var b strings.Builder
+	var long = strings.Repeat("lorem ipsum ", 40)
+	for i := 0; b.Len() < 10<<20; i++ {
+		fmt.Fprintf(&b, "%d, %s ,\"quoted, \"\"field\"\" %d\",%s\n", i, "padded", i, long)
+	}
+	return []byte(b.String())
+}()
+
+func BenchmarkScannerLargeDocument(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(largeCSV)))
+	for i := 0; i < b.N; i++ {
+		s, err := csv.NewScanner(largeCSV)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = s.ScanAll()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScannerRejectTrailingSeparator(t *testing.T) {
+	for _, data := range []string{"a,b,c,", "a,b,c, \nd,e,f", "x,y\na,b,c,\n"} {
+		s, err := csv.NewScanner([]byte(data), csv.RejectTrailingSeparator(true))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.ScanAll()
+		if err == nil {
+			t.Errorf("trailing separator in %q is not reported", data)
+			return
+		}
+		t.Log(err)
+	}
+
+	for _, data := range []string{"a,,c", `a,b,""`, "a,b,c\n"} {
+		s, err := csv.NewScanner([]byte(data), csv.RejectTrailingSeparator(true))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows, err := s.ScanAll()
+		if err != nil {
+			t.Errorf("%q should be scanned, get error %v", data, err)
+			return
+		}
+		if len(rows) != 1 || len(rows[0]) != 3 {
+			t.Errorf("rows of %q are wrong, get %q", data, rows)
+			return
+		}
+	}
+
+	// The rest of the line is shorter than a separator of more than one rune.
+	s, err := csv.NewScanner([]byte(`"a"x`), csv.SeparatorString("||"), csv.RejectTrailingSeparator(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err == nil {
+		t.Error("unexpected character after the quoted field is not reported")
+		return
+	}
+}
+
+func TestNewScannerReader(t *testing.T) {
+	s, err := csv.NewScannerReader(iotest.OneByteReader(strings.NewReader(csvStandard)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected, err := csv.NewScanner([]byte(csvStandard))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expectedRows, err := expected.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, expectedRows) {
+		t.Errorf("rows are wrong, expect %q, get %q", expectedRows, rows)
+		return
+	}
+	printRows(t, rows)
+}
+
+func TestScannerTrailingQuote(t *testing.T) {
+	for _, data := range []string{`abc"`, `abc",def`} {
+		s, err := csv.NewScanner([]byte(data))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		row, err := s.Scan()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if row[0] != `abc"` {
+			t.Errorf("trailing quote is not kept in %q, get %q", data, row)
+			return
+		}
+
+		s, err = csv.NewScanner([]byte(data), csv.TrailingQuote(csv.TrailingQuoteError))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = s.Scan()
+		if err == nil {
+			t.Errorf("trailing quote in %q is not reported", data)
+			return
+		}
+		t.Log(err)
+	}
+
+	// Quotes in the middle of a field are allowed.
+	s, err := csv.NewScanner([]byte(`ab"c,def`), csv.TrailingQuote(csv.TrailingQuoteError))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(row) != 2 || row[0] != `ab"c` {
+		t.Errorf("row is wrong, get %q", row)
+	}
+}
+
+func TestScannerMaxTotalBytes(t *testing.T) {
+	// 30 bytes of fields in total.
+	const data = "aaa,bbb,ccc\nddd,eee,fff\nggg,hhh,iii\njjj"
+	s, err := csv.NewScanner([]byte(data), csv.MaxTotalBytes(30))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 4 {
+		t.Errorf("expect 4 rows, get %d", len(rows))
+		return
+	}
+
+	s, err = csv.NewScanner([]byte(data), csv.MaxTotalBytes(29))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_, err = s.ScanAll()
+	if err != csv.ErrResultTooLarge {
+		t.Errorf("expect ErrResultTooLarge, get %v", err)
+	}
+}
+
+func TestScannerCRLF(t *testing.T) {
+	for _, settings := range [][]csv.Setting{nil, {csv.RFC4180()}} {
+		s, err := csv.NewScanner([]byte("a,b,c\r\nd,e,f\r\n"), settings...)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rows, err := s.ScanAll()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(rows) != 2 || rows[0][2] != "c" || rows[1][2] != "f" {
+			t.Errorf("rows are wrong, get %q", rows)
+			return
+		}
+	}
+
+	// Line ends in quoted fields are read as \n.
+	s, err := csv.NewScanner([]byte("\"a\r\nb\",c\r\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	row, err := s.Scan()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(row) != 2 || row[0] != "a\nb" {
+		t.Errorf("row is wrong, get %q", row)
+		return
+	}
+
+	// A bare \r is a part of the field unless AllowCRLineEnd is enabled.
+	s, err = csv.NewScanner([]byte("a,b\rc,d\r"), csv.AllowCRLineEnd(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err := s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(rows) != 2 || rows[0][1] != "b" || rows[1][1] != "d" {
+		t.Errorf("rows are wrong, get %q", rows)
+		return
+	}
+	if s.DetectedLineEnding() != csv.LineEndingCR {
+		t.Errorf("line ending is wrong, get %q", s.DetectedLineEnding())
+		return
+	}
+
+	// A bare \r in a quoted field is kept as it is.
+	s, err = csv.NewScanner([]byte("\"a\rb\",c\rd,e\r"), csv.AllowCRLineEnd(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rows, err = s.ScanAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(rows, [][]string{{"a\rb", "c"}, {"d", "e"}}) {
+		t.Errorf("rows are wrong, get %q", rows)
+	}
+}
+
+func TestScannerDescribe(t *testing.T) {
+	s, err := csv.NewScanner(nil, csv.Separator(';'), csv.Comment('#'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var description = s.Describe()
+	if !strings.Contains(description, "separator: ';'") || !strings.Contains(description, "comment: '#'") ||
+		!strings.Contains(description, `quote: '"'`) {
+		t.Errorf("description is wrong, get %q", description)
+		return
 	}
+	t.Log(description)
 }
@@ -0,0 +1,221 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// sniffedSeparators are the separators Sniff chooses from, in the order of
+// preference.
+var sniffedSeparators = []rune{',', ';', '\t', '|', ':'}
+
+// A Dialect describes the format of a CSV document detected by Sniff.
+type Dialect struct {
+	Separator rune // Separator between fields.
+	Quote     rune // Quote of fields, a double or single quote.
+	HasHeader bool // Whether the first row is a header row.
+}
+
+// Setting returns a setting which applies d while reading a document, e.g.
+//
+//	dialect, err := csv.Sniff(sample)
+//	...
+//	s, err := csv.NewScanner(data, dialect.Setting())
+//
+// Single quotes are allowed only if d.Quote is a single quote. Double quotes
+// are always allowed.
+func (d Dialect) Setting() Setting {
+	return func(r *rule) {
+		r.setSeparator(d.Separator)
+		r.quote = '"'
+		r.allowSingleQuote = d.Quote == '\''
+		r.header = d.HasHeader
+	}
+}
+
+// Sniff inspects sample, which is usually the first few kilobytes of a CSV
+// document, and returns the detected dialect, in the same way as Python's
+// csv.Sniffer does.
+//
+// The separator is the one among ',', ';', '\t', '|' and ':' which appears the
+// same number of times in most records. The quote is a single quote if more
+// fields start with it than with a double quote. Whether there is a header row
+// is guessed by comparing the types and lengths of the first row with the
+// other rows.
+//
+// If sample ends in the middle of a line, the line is ignored. If no separator
+// is found in sample, an error will be returned.
+func Sniff(sample []byte) (Dialect, error) {
+	if i := bytes.LastIndexByte(sample, '\n'); i >= 0 && i < len(sample)-1 {
+		// The last line is incomplete.
+		sample = sample[:i+1]
+	}
+	if len(bytes.TrimSpace(sample)) == 0 {
+		return Dialect{}, fmt.Errorf("csv: cannot sniff an empty sample")
+	}
+
+	var d = Dialect{Quote: sniffQuote(sample)}
+	var found bool
+	d.Separator, found = sniffSeparator(sample, d.Quote)
+	if !found {
+		return Dialect{}, fmt.Errorf("csv: cannot detect the separator")
+	}
+	d.HasHeader = sniffHeader(sample, d)
+	return d, nil
+}
+
+// sniffQuote returns the quote which more fields in sample start with.
+func sniffQuote(sample []byte) rune {
+	var doubles, singles int
+	var fieldStart = true
+	for _, c := range string(sample) {
+		if fieldStart {
+			switch c {
+			case '"':
+				doubles++
+			case '\'':
+				singles++
+			}
+		}
+		fieldStart = c == '\n' || (c == ' ' && fieldStart) || isSniffedSeparator(c)
+	}
+	if singles > doubles {
+		return '\''
+	}
+	return '"'
+}
+
+// sniffSeparator returns the separator which appears the same number of times
+// in most records of sample. found is false if no separator appears in sample.
+func sniffSeparator(sample []byte, quote rune) (sep rune, found bool) {
+	var bestRecords, bestCount int
+	for _, candidate := range sniffedSeparators {
+		var counts = countInRecords(sample, candidate, quote)
+
+		// The most frequent count of the separator in a record.
+		var frequencies = make(map[int]int)
+		var count, records int
+		for _, n := range counts {
+			frequencies[n]++
+			if frequencies[n] > records || (frequencies[n] == records && n > count) {
+				count, records = n, frequencies[n]
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		if records > bestRecords || (records == bestRecords && count > bestCount) {
+			sep, bestRecords, bestCount, found = candidate, records, count, true
+		}
+	}
+	return sep, found
+}
+
+// countInRecords returns the number of times sep appears out of quoted fields
+// in each non-empty record of sample.
+func countInRecords(sample []byte, sep, quote rune) []int {
+	var counts []int
+	var count, length int
+	var quoted bool
+	for _, c := range string(sample) {
+		switch {
+		case c == quote:
+			// An escaped quote toggles the state twice.
+			quoted = !quoted
+		case c == sep && !quoted:
+			count++
+		case c == '\n' && !quoted:
+			if length > 0 {
+				counts = append(counts, count)
+			}
+			count, length = 0, 0
+			continue
+		case c == '\r':
+			continue
+		}
+		length++
+	}
+	if length > 0 {
+		counts = append(counts, count)
+	}
+	return counts
+}
+
+// sniffHeader guesses whether the first row of sample is a header row. Each
+// column votes for a header if the first field does not fit the type or the
+// length of the fields in the other rows, and against it otherwise.
+func sniffHeader(sample []byte, d Dialect) bool {
+	s, err := NewScanner(sample, d.Setting())
+	if err != nil {
+		return false
+	}
+	header, err := s.Scan()
+	if err != nil {
+		return false
+	}
+	var rows [][]string
+	for {
+		row, err := s.Scan()
+		if err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return false
+	}
+
+	var votes int
+	for col, columnType := range inferTypes(rows) {
+		if col >= len(header) {
+			break
+		}
+		if columnType != StringColumn {
+			if isValidField(header[col], columnType) {
+				votes--
+			} else {
+				votes++
+			}
+			continue
+		}
+
+		// Compare the lengths if all the fields in the column have the same length.
+		var length = -1
+		for _, row := range rows {
+			if col >= len(row) {
+				length = -1
+				break
+			}
+			var n = utf8.RuneCountInString(row[col])
+			if length >= 0 && n != length {
+				length = -1
+				break
+			}
+			length = n
+		}
+		if length < 0 {
+			continue
+		}
+		if utf8.RuneCountInString(header[col]) != length {
+			votes++
+		} else {
+			votes--
+		}
+	}
+	return votes > 0
+}
+
+func isSniffedSeparator(c rune) bool {
+	for _, sep := range sniffedSeparators {
+		if c == sep {
+			return true
+		}
+	}
+	return false
+}
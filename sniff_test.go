@@ -0,0 +1,68 @@
+// Copyright (c) 2018 Beta Kuang
+//
+// This software is released under the MIT License.
+// https://opensource.org/licenses/MIT
+
+package csv_test
+
+import (
+	"testing"
+
+	"github.com/beta/csv"
+)
+
+func TestSniff(t *testing.T) {
+	var cases = []struct {
+		sample   string
+		expected csv.Dialect
+	}{
+		{"name,age,joined\nAlice,30,2018-01-02\nBob,25,2018-03-04\n", csv.Dialect{Separator: ',', Quote: '"', HasHeader: true}},
+		{"1;2.5;true\n3;4.5;false\n", csv.Dialect{Separator: ';', Quote: '"', HasHeader: false}},
+		{"id\tcomment\n1\t\"a, b\"\n2\t\"c; d\"\n3\tef", csv.Dialect{Separator: '\t', Quote: '"', HasHeader: true}},
+		{"'aaa','bbb'\n'ccc','ddd'\n", csv.Dialect{Separator: ',', Quote: '\'', HasHeader: false}},
+	}
+	for _, c := range cases {
+		dialect, err := csv.Sniff([]byte(c.sample))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if dialect != c.expected {
+			t.Errorf("dialect of %q is wrong, expect %+v, get %+v", c.sample, c.expected, dialect)
+			return
+		}
+	}
+
+	for _, sample := range []string{"", "aaa\nbbb\n"} {
+		_, err := csv.Sniff([]byte(sample))
+		if err == nil {
+			t.Errorf("sniffing %q should fail", sample)
+			return
+		}
+	}
+}
+
+func TestSniffAndScan(t *testing.T) {
+	const data = "name|age\nAlice|30\nBob|25"
+	dialect, err := csv.Sniff([]byte(data))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	s, err := csv.NewScanner([]byte(data), dialect.Setting())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	header, rows, err := s.ScanAllWithHeader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(header) != 2 || header[0] != "name" || len(rows) != 2 || rows[1][1] != "25" {
+		t.Errorf("header or rows are wrong, get %q and %q", header, rows)
+		return
+	}
+	printHeader(t, header)
+	printRows(t, rows)
+}
@@ -6,31 +6,141 @@
 package csv
 
 import (
+	"context"
 	"encoding"
 	"fmt"
+	"html"
+	"io"
 	"math"
+	"math/big"
+	"net/url"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	textencoding "golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
 )
 
 const csvTagName = "csv"
 
-// Unmarshal parses a CSV document and stores the result in the struct slice
-// pointed to by dest. If dest is nil or not a pointer to a struct slice,
-// Unmarshal returns an InvalidUnmarshalError.
+// Unmarshal parses a CSV document and stores the result in the slice pointed to
+// by dest, whose elements are structs or struct pointers. If dest is nil or not
+// a pointer to such a slice, Unmarshal returns an InvalidUnmarshalError.
+//
+// Each field with a "csv" struct field tag is unmarshaled from the column named
+// in the tag, followed by the names of validators and "key=value" options,
+// separated by commas. A column name containing commas can be quoted with
+// single quotes, with single quotes in it doubled, e.g.
+//
+//	Revenue float64 `csv:"'Revenue, USD',positive"`
+//
+// A time.Time field is unmarshaled from the RFC 3339 format, or from the
+// layout given with a "layout" option, which must not contain commas, e.g.
+//
+//	CreatedAt time.Time `csv:"created_at,layout=2006-01-02"`
+//
+// A value parsed with a layout without a time zone is in the location set with
+// the TimeLocation setting.
+//
+// A field with a "required" option in the tag must have its column in the
+// header, or an error listing the missing columns will be returned. An empty
+// field in a present column is not an error.
+//
+// A pointer field is set to a newly allocated value, or nil if the field in the
+// document is empty.
+//
+// An empty field is unmarshaled from the value given with a "default" option
+// instead, which must not contain commas, e.g.
+//
+//	Age int `csv:"age,default=18"`
+//
+// A pointer field with a default value is never nil.
+//
+// A field with an "encoding" option is decoded with the named encoding instead
+// of the document encoding, e.g. a Shift-JIS column in a UTF-8 document:
+//
+//	Text string `csv:"text,encoding=shift_jis"`
+//
+// The document encoding must encode ASCII characters as single bytes, like
+// UTF-8 and single-byte encodings, but unlike UTF-16.
+//
+// If the document has no data rows, e.g. it is empty, contains only spaces and
+// line breaks, or contains only the header row, the slice pointed to by dest is
+// set to an empty non-nil slice. A header row is still checked for required
+// and unknown columns.
 func Unmarshal(data []byte, dest interface{}, settings ...Setting) error {
+	_, err := UnmarshalWithResult(data, dest, settings...)
+	return err
+}
+
+// UnmarshalWithResult works in the same way as Unmarshal, and also returns the
+// numbers of rows read, unmarshaled and failed. With the ContinueOnError
+// setting, the errors of failed rows are returned in the result instead of
+// failing the whole unmarshaling.
+func UnmarshalWithResult(data []byte, dest interface{}, settings ...Setting) (Result, error) {
+	return unmarshalContext(context.Background(), data, dest, settings...)
+}
+
+// UnmarshalContext works in the same way as Unmarshal, and stops unmarshaling
+// once ctx is done. ctx is checked before scanning every data row, so the rest
+// of the document is not scanned after ctx is done. Its error is returned as it
+// is, with the rows unmarshaled so far kept in the slice pointed to by dest.
+func UnmarshalContext(ctx context.Context, data []byte, dest interface{}, settings ...Setting) error {
+	_, err := unmarshalContext(ctx, data, dest, settings...)
+	return err
+}
+
+// ScanAllInto works in the same way as Unmarshal, and returns the unmarshaled
+// rows as a slice of T, which is a struct or struct pointer type, e.g.
+//
+//	persons, err := csv.ScanAllInto[Person](data)
+//
+// If an error occurs, rows will be returned as nil.
+func ScanAllInto[T any](data []byte, settings ...Setting) (rows []T, err error) {
+	err = Unmarshal(data, &rows, settings...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func unmarshalContext(ctx context.Context, data []byte, dest interface{}, settings ...Setting) (Result, error) {
 	var v = reflect.ValueOf(dest)
 	if v.IsNil() {
-		return &InvalidUnmarshalError{Type: nil}
+		return Result{}, &InvalidUnmarshalError{Type: nil}
 	}
 	if v.Type().Kind() != reflect.Ptr || v.Type().Elem().Kind() != reflect.Slice ||
-		v.Type().Elem().Elem().Kind() != reflect.Ptr || v.Type().Elem().Elem().Elem().Kind() != reflect.Struct {
-		return &InvalidUnmarshalError{Type: reflect.TypeOf(dest)}
+		elemStructType(v.Type().Elem()) == nil {
+		return Result{}, &InvalidUnmarshalError{Type: reflect.TypeOf(dest)}
 	}
 
 	var u = newUnmarshaler(data, dest, settings...)
-	return u.unmarshal()
+	u.ctx = ctx
+	var err = u.unmarshal()
+	return u.result, err
+}
+
+// A Result is the summary of unmarshaling a document.
+type Result struct {
+	Read   int         // Number of data rows read.
+	OK     int         // Number of rows unmarshaled into the destination slice.
+	Failed int         // Number of rows failed to be unmarshaled.
+	Errors []*RowError // Errors of failed rows, only collected with the ContinueOnError setting.
+}
+
+// A RowError describes an error of unmarshaling a data row.
+type RowError struct {
+	Row int // Index of the data row, starting from 1.
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("csv: row %d: %s", e.Row, strings.TrimPrefix(e.Err.Error(), "csv: "))
 }
 
 func newUnmarshaler(data []byte, dest interface{}, settings ...Setting) *unmarshaler {
@@ -48,12 +158,16 @@ func newUnmarshaler(data []byte, dest interface{}, settings ...Setting) *unmarsh
 
 type unmarshaler struct {
 	rule rule
+	ctx  context.Context
 
 	data     []byte
 	dest     interface{}
 	settings []Setting
 
-	fieldMap map[string]*field // Key is the CSV header name of the field.
+	fieldMap      map[string]*field // Key is the CSV header name of the field, in lower case with HeaderCaseInsensitive.
+	overflowField *field            // Field capturing the columns beyond the header, nil if not set.
+
+	result Result
 }
 
 func (u *unmarshaler) error(err error) error {
@@ -63,34 +177,123 @@ func (u *unmarshaler) error(err error) error {
 	return err
 }
 
-func (u *unmarshaler) prepareFields() {
-	// u.dest is a pointer to struct pointer slice.
-	var structType = reflect.TypeOf(u.dest).Elem().Elem().Elem()
-	var fieldMap = make(map[string]*field, structType.NumField())
+// structFieldsCache caches the *structFields parsed from struct types. Key is
+// a structFieldsKey.
+var structFieldsCache sync.Map
+
+// structFieldsKey is the key of structFieldsCache.
+type structFieldsKey struct {
+	structType reflect.Type
+	tagKey     string
+}
+
+// structFields is the info of all the fields in a struct type. It depends only
+// on the struct type and the tag key, so it is shared by all unmarshalers and must not be
+// modified after being parsed.
+type structFields struct {
+	fieldMap      map[string]*field
+	overflowField *field
+}
+
+func (u *unmarshaler) prepareFields() error {
+	// u.dest is a pointer to a struct or struct pointer slice.
+	var structType = elemStructType(reflect.TypeOf(u.dest).Elem())
+	var key = structFieldsKey{structType: structType, tagKey: u.rule.tagKey}
+	var fields *structFields
+	if cached, exist := structFieldsCache.Load(key); exist {
+		fields = cached.(*structFields)
+	} else {
+		var err error
+		fields, err = parseStructFields(structType, u.rule.tagKey)
+		if err != nil {
+			return err
+		}
+		structFieldsCache.Store(key, fields)
+	}
+	u.fieldMap = fields.fieldMap
+	u.overflowField = fields.overflowField
+	if u.rule.headerCaseInsensitive {
+		return u.foldFieldMap()
+	}
+	return nil
+}
+
+// foldFieldMap replaces u.fieldMap with a copy keyed by the header names in
+// lower case. The cached map is shared, so it is not modified.
+func (u *unmarshaler) foldFieldMap() error {
+	var folded = make(map[string]*field, len(u.fieldMap))
+	for name, field := range u.fieldMap {
+		var key = strings.ToLower(name)
+		if other, exist := folded[key]; exist {
+			return fmt.Errorf("fields %s and %s have the same header name ignoring case", other.Name, field.Name)
+		}
+		folded[key] = field
+	}
+	u.fieldMap = folded
+	return nil
+}
+
+// parseStructFields parses the struct field tags of structType with tagKey.
+func parseStructFields(structType reflect.Type, tagKey string) (*structFields, error) {
+	var fields = &structFields{
+		fieldMap: make(map[string]*field, structType.NumField()),
+	}
 	for i := 0; i < structType.NumField(); i++ {
 		var structField = structType.Field(i)
-		if tag, exist := structField.Tag.Lookup(csvTagName); exist {
-			var tagParts = strings.Split(tag, ",")
-			var csvName = tagParts[0]
-			if csvName == "-" {
+		if tag, exist := structField.Tag.Lookup(tagKey); exist {
+			if tag == "-" {
 				continue
 			}
-
-			var validatorNames = make([]string, 0, len(tagParts)-1)
-			for i := 1; i < len(tagParts); i++ {
-				validatorNames = append(validatorNames, tagParts[i])
+			tagParts, err := splitTag(tag)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag of field %s: %v", structField.Name, err)
 			}
+			var csvName = tagParts[0]
 
 			var field = &field{
 				Name:           structField.Name,
 				Type:           structField.Type,
 				CSVName:        csvName,
-				ValidatorNames: validatorNames,
+				ValidatorNames: make([]string, 0, len(tagParts)-1),
+			}
+			for i := 1; i < len(tagParts); i++ {
+				if tagParts[i] == "" {
+					continue
+				}
+				// Options are in the form of "key=value", others are validator names.
+				if eq := strings.Index(tagParts[i], "="); eq >= 0 {
+					var err = field.setOption(tagParts[i][:eq], tagParts[i][eq+1:])
+					if err != nil {
+						return nil, err
+					}
+					continue
+				}
+				if tagParts[i] == "overflow" {
+					field.Overflow = true
+					continue
+				}
+				if tagParts[i] == "required" {
+					field.Required = true
+					continue
+				}
+				field.ValidatorNames = append(field.ValidatorNames, tagParts[i])
+			}
+
+			if field.Method != "" {
+				// The column is computed by a method, and not unmarshaled.
+				continue
+			}
+			if field.Overflow {
+				if field.Type != reflect.TypeOf([]string(nil)) {
+					return nil, fmt.Errorf("overflow field %s must be of type []string", field.Name)
+				}
+				fields.overflowField = field
+				continue
 			}
-			fieldMap[csvName] = field
+			fields.fieldMap[csvName] = field
 		}
 	}
-	u.fieldMap = fieldMap
+	return fields, nil
 }
 
 // Info of a field in the target struct.
@@ -99,72 +302,275 @@ type field struct {
 	Type           reflect.Type
 	CSVName        string
 	ValidatorNames []string
+	Encoding       textencoding.Encoding // Encoding of the raw field value, nil if not set.
+	Decode         string                // How the field value is escaped, "url" or "html", empty if not escaped.
+	Method         string                // Method marshaled instead of the field, empty if not set.
+	Overflow       bool                  // Whether the field captures the columns beyond the header.
+	Layout         string                // Layout of a time.Time field, empty if not set.
+	Required       bool                  // Whether the column of the field must be in the header.
+	Default        string                // Value parsed instead of an empty field, empty if not set.
 }
 
-func (u *unmarshaler) unmarshal() error {
-	u.prepareFields()
+// splitTag splits a "csv" struct field tag into the CSV name and other parts.
+// The name can be quoted with single quotes, so that it can contain commas,
+// e.g. `csv:"'Revenue, USD',positive"`. A single quote in a quoted name is
+// escaped by doubling it.
+func splitTag(tag string) ([]string, error) {
+	if !strings.HasPrefix(tag, "'") {
+		return strings.Split(tag, ","), nil
+	}
+
+	var name []byte
+	for i := 1; i < len(tag); i++ {
+		if tag[i] != '\'' {
+			name = append(name, tag[i])
+			continue
+		}
+		if i+1 < len(tag) && tag[i+1] == '\'' {
+			// Escaped quote.
+			name = append(name, '\'')
+			i++
+			continue
+		}
+		// Closing quote.
+		var rest = tag[i+1:]
+		if rest == "" {
+			return []string{string(name)}, nil
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("unexpected %q after the quoted name", rest[0])
+		}
+		return append([]string{string(name)}, strings.Split(rest[1:], ",")...), nil
+	}
+	return nil, fmt.Errorf("quoted name is not closed")
+}
+
+// setOption sets a "key=value" option in the "csv" struct field tag.
+func (f *field) setOption(key, value string) error {
+	switch key {
+	case "encoding":
+		enc, exist := encodings[normalizeEncodingName(value)]
+		if !exist {
+			return fmt.Errorf("unknown encoding %s for field %s", value, f.Name)
+		}
+		f.Encoding = enc
+		return nil
+	case "method":
+		// Only used while marshaling.
+		f.Method = value
+		return nil
+	case "decode":
+		if value != "url" && value != "html" {
+			return fmt.Errorf("unknown decoding %s for field %s", value, f.Name)
+		}
+		f.Decode = value
+		return nil
+	case "default":
+		f.Default = value
+		return nil
+	case "layout":
+		if !isTimeType(f.Type) {
+			return fmt.Errorf("layout option for field %s of non-time type %s", f.Name, f.Type)
+		}
+		f.Layout = value
+		return nil
+	}
+	return fmt.Errorf("unknown option %s for field %s", key, f.Name)
+}
 
-	s, err := NewScanner(u.data, u.settings...)
+func (u *unmarshaler) unmarshal() error {
+	var err = u.prepareFields()
 	if err != nil {
 		return u.error(err)
 	}
 
-	var originalPrefix = s.rule.prefix
-	var originalSuffix = s.rule.suffix
-	if u.rule.headerPrefix != noRune {
-		s.rule.prefix = u.rule.headerPrefix
+	var settings = u.settings
+	var raw = u.hasFieldEncoding()
+	if raw {
+		if !isASCIICompatible(u.rule.encoding) {
+			return u.error(fmt.Errorf("the encoding option of fields requires a document encoding compatible with ASCII"))
+		}
+		// The document is scanned as raw bytes, and each field is decoded with the
+		// encoding of its column by decodeRaw.
+		settings = append(settings[:len(settings):len(settings)], Encoding(rawEncoding{}))
+	}
+	s, err := NewScanner(u.data, settings...)
+	if err != nil {
+		return u.error(err)
 	}
-	if u.rule.headerSuffix != noRune {
-		s.rule.suffix = u.rule.headerSuffix
+	s.rule.progress = nil // Progress is reported with data rows below.
+	if raw {
+		// Applied to the decoded fields below.
+		s.rule.fieldTransform = nil
+		s.rule.validateHeader = nil
+		s.rule.requireValidUTF8 = false
+		s.rule.maxTotalBytes = 0
 	}
-	header, err := s.Scan()
+
+	header, err := s.scanValidHeader()
 	if err != nil {
 		return u.error(err)
 	}
-	s.rule.prefix = originalPrefix
-	s.rule.suffix = originalSuffix
+	var encodings []textencoding.Encoding
+	if raw {
+		encodings, err = u.decodeRawHeader(header)
+		if err != nil {
+			return u.error(err)
+		}
+	}
 
-	if u.rule.fieldPrefix != noRune {
-		s.rule.prefix = u.rule.fieldPrefix
+	var sliceV = reflect.ValueOf(u.dest).Elem() // u.dest is a pointer to a struct or struct pointer slice.
+	var structType = elemStructType(sliceV.Type())
+	if sliceV.IsNil() {
+		sliceV.Set(reflect.MakeSlice(sliceV.Type(), 0, 0))
+	}
+	if header == nil {
+		if s.AtEOF() {
+			return nil
+		}
+		return u.error(fmt.Errorf("no header found, use the HeaderNames setting to give one"))
 	}
-	if u.rule.fieldSuffix != noRune {
-		s.rule.suffix = u.rule.fieldSuffix
+
+	// Fields are looked up with keys, and the original header is kept.
+	var keys = header
+	if u.rule.headerCaseInsensitive {
+		keys = make([]string, len(header))
+		for i, name := range header {
+			keys[i] = strings.ToLower(name)
+		}
 	}
-	rows, err := s.ScanAll()
+	err = u.checkRequiredColumns(keys)
 	if err != nil {
 		return u.error(err)
 	}
-
-	var sliceV = reflect.ValueOf(u.dest).Elem() // u.dest is a pointer to struct pointer slice.
-	for rowIndex, row := range rows {
-		var rowCount = rowIndex + 1
-		if rowCount > sliceV.Cap() {
-			// Grow slice.
-			var newCap = sliceV.Cap() + sliceV.Cap()/2
-			if newCap < 4 {
-				newCap = 4
+	if u.rule.disallowUnknownColumns {
+		for i, key := range keys {
+			if _, exist := u.fieldMap[key]; !exist {
+				return u.error(fmt.Errorf("unknown column %s in the header", header[i]))
 			}
-			var newSliceV = reflect.MakeSlice(sliceV.Type(), sliceV.Len(), newCap)
-			reflect.Copy(newSliceV, sliceV)
-			sliceV.Set(newSliceV)
 		}
-		if rowCount >= sliceV.Len() {
-			sliceV.SetLen(rowCount)
+	}
+
+	// Rows are scanned and unmarshaled one by one, so that ctx is also checked
+	// while scanning the document.
+	var totalBytes int
+	for rowCount := 1; ; rowCount++ {
+		err = u.ctx.Err()
+		if err != nil {
+			return err
 		}
 
-		var obj = reflect.New(sliceV.Type().Elem().Elem())
-		sliceV.Index(rowIndex).Set(obj)
-		err = u.unmarshalRecord(sliceV.Index(rowIndex), header, row)
+		row, err := s.scanDataRow(header, rowCount)
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
 			return u.error(err)
 		}
+		if raw {
+			err = u.decodeRawRow(row, encodings, rowCount)
+			if err != nil {
+				return u.error(err)
+			}
+		}
+		// Decoded fields are counted.
+		if u.rule.maxTotalBytes > 0 {
+			for _, field := range row {
+				totalBytes += len(field)
+			}
+			if totalBytes > u.rule.maxTotalBytes {
+				return ErrResultTooLarge
+			}
+		}
+
+		u.result.Read++
+		var obj = reflect.New(structType)
+		err = u.unmarshalRow(obj, keys, row)
+		if err != nil {
+			var rowErr = &RowError{Row: rowCount, Err: err}
+			if !u.rule.continueOnError {
+				return rowErr
+			}
+			u.result.Failed++
+			u.result.Errors = append(u.result.Errors, rowErr)
+		} else {
+			u.appendRow(sliceV, obj)
+		}
+		if u.rule.progress != nil && u.rule.progressEvery > 0 && rowCount%u.rule.progressEvery == 0 {
+			u.rule.progress(rowCount)
+		}
 	}
 
 	return nil
 }
 
+// checkRequiredColumns returns an error listing the columns of required fields
+// which are not in the header. keys are the header names used to look up
+// fields.
+func (u *unmarshaler) checkRequiredColumns(keys []string) error {
+	var found = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		found[key] = true
+	}
+	var missing []string
+	for key, field := range u.fieldMap {
+		if field.Required && !found[key] {
+			missing = append(missing, field.CSVName)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("missing required columns %s in the header", strings.Join(missing, ", "))
+}
+
+// unmarshalRow checks the number of fields in row, and unmarshals it into the
+// struct pointed to by dest.
+func (u *unmarshaler) unmarshalRow(dest reflect.Value, header []string, row []string) error {
+	if u.rule.headerNames != nil && len(row) != len(u.rule.headerNames) &&
+		!(u.overflowField != nil && len(row) > len(u.rule.headerNames)) {
+		return fmt.Errorf("%d fields found but %d header names are given", len(row), len(u.rule.headerNames))
+	}
+	return u.unmarshalRecord(dest, header, row)
+}
+
+// appendRow sets obj, a struct pointer, as the next unmarshaled row in sliceV,
+// growing the slice if necessary. If the elements of sliceV are structs, the
+// struct pointed to by obj is copied.
+func (u *unmarshaler) appendRow(sliceV reflect.Value, obj reflect.Value) {
+	var index = u.result.OK
+	if index+1 > sliceV.Cap() {
+		// Grow slice.
+		var newCap = sliceV.Cap() + sliceV.Cap()/2
+		if newCap < 4 {
+			newCap = 4
+		}
+		var newSliceV = reflect.MakeSlice(sliceV.Type(), sliceV.Len(), newCap)
+		reflect.Copy(newSliceV, sliceV)
+		sliceV.Set(newSliceV)
+	}
+	if index >= sliceV.Len() {
+		sliceV.SetLen(index + 1)
+	}
+	if sliceV.Type().Elem().Kind() == reflect.Struct {
+		obj = obj.Elem()
+	}
+	sliceV.Index(index).Set(obj)
+	u.result.OK++
+}
+
 func (u *unmarshaler) unmarshalRecord(dest reflect.Value, header []string, row []string) error {
+	if len(row) > len(header) && u.overflowField == nil {
+		return fmt.Errorf("%d fields found but the header has %d columns", len(row), len(header))
+	}
 	for i, value := range row {
+		if i >= len(header) {
+			var overflow = dest.Elem().FieldByName(u.overflowField.Name)
+			overflow.Set(reflect.Append(overflow, reflect.ValueOf(value)))
+			continue
+		}
+
 		var name = header[i]
 		field, exist := u.fieldMap[name]
 		if !exist {
@@ -180,27 +586,77 @@ func (u *unmarshaler) unmarshalRecord(dest reflect.Value, header []string, row [
 }
 
 func (u *unmarshaler) unmarshalField(field *field, dest reflect.Value, value string) error {
-	// Validation.
+	if field.Decode != "" {
+		var err error
+		value, err = unescapeField(field, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	if value == "" && field.Default != "" {
+		value = field.Default
+	}
+
+	// Raw values are validated before being parsed.
+	for _, validatorName := range field.ValidatorNames {
+		if validator, exist := u.rule.rawValidators[validatorName]; exist && !validator(value) {
+			return fmt.Errorf("invalid value %s for field %s", value, field.Name)
+		}
+	}
+
+	var err = u.setField(dest, value, field.Layout)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal %q into field %s: %v", value, field.Name, err)
+	}
+
 	for _, validatorName := range field.ValidatorNames {
+		if _, exist := u.rule.rawValidators[validatorName]; exist {
+			continue
+		}
 		validator, exist := u.rule.validators[validatorName]
 		if !exist {
 			return fmt.Errorf("cannot find validator %s", validatorName)
 		}
-		if !validator(value) {
+		if !validator(dest.Interface()) {
 			return fmt.Errorf("invalid value %s for field %s", value, field.Name)
 		}
 	}
+	return nil
+}
 
-	if tu, ok := dest.Interface().(encoding.TextUnmarshaler); ok {
-		return tu.UnmarshalText([]byte(value))
-		// dest.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+// setField parses value into dest, with layout if dest is a time.Time. If dest
+// is a pointer, a new value is allocated and parsed into, and an empty value
+// sets the pointer nil, so that an empty field is distinguished from a zero
+// value.
+func (u *unmarshaler) setField(dest reflect.Value, value string, layout string) error {
+	if dest.Kind() == reflect.Ptr {
+		if value == "" {
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		var elem = reflect.New(dest.Type().Elem())
+		var err = u.setField(elem.Elem(), value, layout)
+		if err != nil {
+			return err
+		}
+		dest.Set(elem)
+		return nil
+	}
+	if layout != "" {
+		return u.setTime(dest, value, layout)
 	}
 
+	// Fields of a row are always addressable, as the row is allocated with
+	// reflect.New, so UnmarshalText with a pointer receiver is found.
 	if dest.CanAddr() {
 		if tu, ok := dest.Addr().Interface().(encoding.TextUnmarshaler); ok {
 			return tu.UnmarshalText([]byte(value))
 		}
 	}
+	if tu, ok := dest.Interface().(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(value))
+	}
 
 	var k = dest.Type().Kind()
 	if reflect.Int <= k && k <= reflect.Uint64 {
@@ -217,53 +673,257 @@ func (u *unmarshaler) unmarshalField(field *field, dest reflect.Value, value str
 	return fmt.Errorf("unsupported Go type %s", dest.Type().String())
 }
 
-func (u *unmarshaler) unmarshalInt(dest reflect.Value, value string) error {
-	intVal, err := strconv.ParseInt(value, 10, 64)
+// setTime parses value with layout and stores it into dest, which is a
+// time.Time.
+func (u *unmarshaler) setTime(dest reflect.Value, value string, layout string) error {
+	var loc = u.rule.timeLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
 	if err != nil {
 		return err
 	}
-	var uintVal = uint64(intVal)
-
-	// Check integer range.
-	var outOfRange = false
-	var unsigned = false
-
-	if k := dest.Kind(); k >= reflect.Int && k <= reflect.Int64 {
-		switch k {
-		case reflect.Int, reflect.Int64:
-			// No checking needed.
-		case reflect.Int8:
-			outOfRange = intVal < math.MinInt8 || intVal > math.MaxInt8
-		case reflect.Int16:
-			outOfRange = intVal < math.MinInt16 || intVal > math.MaxInt16
-		case reflect.Int32:
-			outOfRange = intVal < math.MinInt32 || intVal > math.MaxInt32
-		}
-	} else if k >= reflect.Uint && k <= reflect.Uint64 {
-		unsigned = true
-		switch k {
-		case reflect.Uint, reflect.Uint64:
-			// No checking needed.
-		case reflect.Int8:
-			outOfRange = intVal < 0 || uintVal > math.MaxUint8
-		case reflect.Int16:
-			outOfRange = intVal < 0 || uintVal > math.MaxUint16
-		case reflect.Int32:
-			outOfRange = intVal < 0 || uintVal > math.MaxUint32
-		}
-	}
-
-	if outOfRange {
-		return fmt.Errorf("value %s is out of range for type %s", value, dest.Type().String())
-	}
-	if !unsigned {
+	dest.Set(reflect.ValueOf(t))
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// isTimeType reports whether t is time.Time or *time.Time.
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || (t.Kind() == reflect.Ptr && t.Elem() == timeType)
+}
+
+// hasFieldEncoding reports whether any field has the encoding option.
+func (u *unmarshaler) hasFieldEncoding() bool {
+	for _, field := range u.fieldMap {
+		if field.Encoding != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeRawHeader decodes the header scanned as raw bytes with rawEncoding
+// with the document encoding, and checks it with the ValidateHeader setting.
+// The header is only decoded if it is scanned from the document, not given
+// with the HeaderNames setting.
+//
+// The returned encodings are the encodings of the columns, which are the
+// encodings of the fields with the encoding option, or the document encoding
+// for other columns.
+func (u *unmarshaler) decodeRawHeader(header []string) (encodings []textencoding.Encoding, err error) {
+	if u.rule.headerNames == nil {
+		for i, name := range header {
+			header[i], err = decodeRawField(name, u.rule.encoding)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode header: %v", err)
+			}
+			if u.rule.requireValidUTF8 && !isValidUTF8(header[i]) {
+				return nil, fmt.Errorf("invalid UTF-8 in header %q", header[i])
+			}
+		}
+	}
+	if u.rule.validateHeader != nil && header != nil {
+		err = u.rule.validateHeader(header)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %q: %v", header, err)
+		}
+	}
+
+	encodings = make([]textencoding.Encoding, len(header))
+	for i, name := range header {
+		if u.rule.headerCaseInsensitive {
+			name = strings.ToLower(name)
+		}
+		encodings[i] = u.rule.encoding
+		if field, exist := u.fieldMap[name]; exist && field.Encoding != nil {
+			encodings[i] = field.Encoding
+		}
+	}
+	return encodings, nil
+}
+
+// decodeRawRow decodes the fields of a data row scanned as raw bytes with
+// rawEncoding with the encodings of their columns, and applies the
+// RequireValidUTF8 and FieldTransform settings after decoding. Fields beyond the header are decoded
+// with the document encoding. index is the number of the data row used in
+// errors, starting from 1.
+func (u *unmarshaler) decodeRawRow(row []string, encodings []textencoding.Encoding, index int) error {
+	for col, value := range row {
+		var enc = u.rule.encoding
+		if col < len(encodings) {
+			enc = encodings[col]
+		}
+		value, err := decodeRawField(value, enc)
+		if err != nil {
+			return fmt.Errorf("cannot decode field %d of data row %d: %v", col, index, err)
+		}
+		if u.rule.requireValidUTF8 && !isValidUTF8(value) {
+			return fmt.Errorf("invalid UTF-8 in field %q of data row %d", value, index)
+		}
+		if u.rule.fieldTransform != nil {
+			value = u.rule.fieldTransform(col, value)
+		}
+		row[col] = value
+	}
+	return nil
+}
+
+// decodeRawField decodes value scanned with rawEncoding with enc.
+func decodeRawField(value string, enc textencoding.Encoding) (string, error) {
+	raw, err := rawEncoding{}.NewEncoder().String(value)
+	if err != nil {
+		return "", err
+	}
+	return enc.NewDecoder().String(raw)
+}
+
+// isASCIICompatible reports whether enc encodes ASCII characters as single
+// bytes of the same values, so that a document in enc could be scanned as raw
+// bytes with rawEncoding.
+func isASCIICompatible(enc textencoding.Encoding) bool {
+	const ascii = "\t\r\n !\"#'(),-.0123456789:;<=>?@AZ[\\]_az{|}~"
+	encoded, err := enc.NewEncoder().String(ascii)
+	return err == nil && encoded == ascii
+}
+
+// rawRuneBase is the start of the runes which bytes not in ASCII are decoded
+// to by rawEncoding. They are in the private use area, so they are never
+// separators, quotes or spaces.
+const rawRuneBase = 0xF700
+
+// rawEncoding decodes every byte of a document as a rune, so that the raw bytes
+// of a field could be recovered with its encoder and decoded with the encoding
+// of the field. ASCII bytes are decoded as they are, and other bytes are
+// decoded to rawRuneBase plus the byte.
+type rawEncoding struct{}
+
+func (rawEncoding) NewDecoder() *textencoding.Decoder {
+	return &textencoding.Decoder{Transformer: rawDecoder{}}
+}
+
+func (rawEncoding) NewEncoder() *textencoding.Encoder {
+	return &textencoding.Encoder{Transformer: rawEncoder{}}
+}
+
+type rawDecoder struct{ transform.NopResetter }
+
+func (rawDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		var c = rune(src[nSrc])
+		if c >= utf8.RuneSelf {
+			c += rawRuneBase
+		}
+		if nDst+utf8.RuneLen(c) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], c)
+	}
+	return nDst, nSrc, nil
+}
+
+type rawEncoder struct{ transform.NopResetter }
+
+func (rawEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		c, size := utf8.DecodeRune(src[nSrc:])
+		if c >= rawRuneBase+utf8.RuneSelf && c <= rawRuneBase+0xFF {
+			c -= rawRuneBase
+		} else if c >= utf8.RuneSelf {
+			return nDst, nSrc, fmt.Errorf("rune %U is not a raw byte", c)
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = byte(c)
+		nDst++
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+// unescapeField unescapes value with the "decode" option of field.
+func unescapeField(field *field, value string) (string, error) {
+	switch field.Decode {
+	case "url":
+		unescaped, err := url.QueryUnescape(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot URL-decode value of field %s: %v", field.Name, err)
+		}
+		return unescaped, nil
+	case "html":
+		return html.UnescapeString(value), nil
+	}
+	return value, nil
+}
+
+func (u *unmarshaler) unmarshalInt(dest reflect.Value, value string) error {
+	var k = dest.Kind()
+	var signed = k >= reflect.Int && k <= reflect.Int64
+	var bitSize = dest.Type().Bits()
+
+	if u.rule.intOverflow == OverflowWrap {
+		// Keep the lowest bits of the two's complement representation.
+		intVal, ok := new(big.Int).SetString(value, 10)
+		if !ok {
+			return fmt.Errorf("invalid integer value %s", value)
+		}
+		var mask = new(big.Int).Lsh(big.NewInt(1), uint(bitSize))
+		var wrapped = intVal.And(intVal, mask.Sub(mask, big.NewInt(1))).Uint64()
+		if signed {
+			dest.SetInt(int64(wrapped << uint(64-bitSize) >> uint(64-bitSize)))
+		} else {
+			dest.SetUint(wrapped)
+		}
+		return nil
+	}
+
+	if signed {
+		// ParseInt returns the nearest valid value if value is out of range.
+		intVal, err := strconv.ParseInt(value, 10, bitSize)
+		if err != nil {
+			if !isRangeError(err) {
+				return err
+			}
+			if u.rule.intOverflow != OverflowClamp {
+				return fmt.Errorf("value %s is out of range for type %s", value, dest.Type().String())
+			}
+		}
 		dest.SetInt(intVal)
-	} else {
-		dest.SetUint(uintVal)
+		return nil
+	}
+
+	// ParseUint returns the maximum value if value is out of range, but it does
+	// not accept negative values.
+	uintVal, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		_, intErr := strconv.ParseInt(value, 10, 64)
+		var negative = strings.HasPrefix(value, "-") && (intErr == nil || isRangeError(intErr))
+		if !isRangeError(err) && !negative {
+			return err
+		}
+		if u.rule.intOverflow != OverflowClamp {
+			return fmt.Errorf("value %s is out of range for type %s", value, dest.Type().String())
+		}
+		if negative {
+			uintVal = 0
+		}
 	}
+	dest.SetUint(uintVal)
 	return nil
 }
 
+// isRangeError reports whether err is a strconv.ErrRange error.
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
 func (u *unmarshaler) unmarshalBool(dest reflect.Value, value string) error {
 	boolVal, err := strconv.ParseBool(value)
 	if err != nil {
@@ -275,22 +935,24 @@ func (u *unmarshaler) unmarshalBool(dest reflect.Value, value string) error {
 }
 
 func (u *unmarshaler) unmarshalFloat(dest reflect.Value, value string) error {
-	floatVal, err := strconv.ParseFloat(value, 64)
+	// ParseFloat returns an infinity if value is out of range.
+	floatVal, err := strconv.ParseFloat(value, dest.Type().Bits())
 	if err != nil {
-		return err
-	}
-
-	// Check float range.
-	var outOfRange = false
-	switch k := dest.Kind(); k {
-	case reflect.Float32:
-		outOfRange = floatVal > math.MaxFloat32
-	case reflect.Float64:
-		// No checking needed.
-	}
-
-	if outOfRange {
-		return fmt.Errorf("value %s is out of range for type %s", value, dest.Type().String())
+		if !isRangeError(err) {
+			return err
+		}
+		switch u.rule.intOverflow {
+		case OverflowClamp:
+			var max = math.MaxFloat64
+			if dest.Kind() == reflect.Float32 {
+				max = math.MaxFloat32
+			}
+			floatVal = math.Copysign(max, floatVal)
+		case OverflowWrap:
+			// Floats overflow to infinities.
+		default:
+			return fmt.Errorf("value %s is out of range for type %s", value, dest.Type().String())
+		}
 	}
 	dest.SetFloat(floatVal)
 	return nil
@@ -312,5 +974,5 @@ func (e *InvalidUnmarshalError) Error() string {
 		return "csv: Unmarshal(nil)"
 	}
 
-	return "csv: Unmarshal(" + e.Type.String() + " is not a pointer to a struct pointer slice)"
+	return "csv: Unmarshal(" + e.Type.String() + " is not a pointer to a struct or struct pointer slice)"
 }
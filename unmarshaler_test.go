@@ -6,11 +6,17 @@
 package csv_test
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/beta/csv"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
 )
 
 const (
@@ -24,6 +30,11 @@ John,Smith,0,true,1234567890`
 	calendarCSVWithPrefixAndSuffix = `[first_name],[last_name],[age],[married],[phone]
 (John),(Smith),(25),(true),(1234567890)
 (Mary),(Jane),(23),(false),(9876543210)`
+	headerlessCalendarCSV = `John,Smith,25,true,1234567890
+Mary,Jane,23,false,9876543210`
+	calendarCSVWithTabSeparatedHeader = "first_name\tlast_name\tage\tmarried\tphone\n" +
+		`John,Smith,25,true,1234567890
+Mary,Jane,23,false,9876543210`
 )
 
 type Person struct {
@@ -83,14 +94,93 @@ func TestUnmarshalCustomType(t *testing.T) {
 }
 
 func TestUnmarshalInvalidType(t *testing.T) {
+	var persons []**Person
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons)
+	if err == nil || !strings.Contains(err.Error(), "is not a pointer to a struct or struct pointer slice") {
+		t.Errorf("invalid type is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+func TestUnmarshalIntoStructSlice(t *testing.T) {
 	var persons []Person
 	var err = csv.Unmarshal([]byte(calendarCSV), &persons)
 	if err != nil {
-		if strings.Contains(err.Error(), "is not a pointer to a struct pointer slice") {
-			t.Log(err)
+		t.Error(err)
+		return
+	}
+	var expected []*Person
+	err = csv.Unmarshal([]byte(calendarCSV), &expected)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != len(expected) {
+		t.Errorf("expect %d persons, get %d", len(expected), len(persons))
+		return
+	}
+	for i := range persons {
+		if !reflect.DeepEqual(persons[i], *expected[i]) {
+			t.Errorf("person #%d is wrong, expect %+v, get %+v", i, *expected[i], persons[i])
 			return
 		}
+	}
+}
+
+func TestScanAllInto(t *testing.T) {
+	persons, err := csv.ScanAllInto[Person]([]byte(calendarCSV))
+	if err != nil {
 		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" || persons[1].Age != 23 {
+		t.Errorf("persons are wrong, get %+v", persons)
+		return
+	}
+
+	_, err = csv.ScanAllInto[string]([]byte(calendarCSV))
+	if err == nil {
+		t.Errorf("invalid type is not reported")
+	}
+}
+
+// Code is unmarshaled in upper case with a pointer receiver.
+type Code string
+
+func (c *Code) UnmarshalText(text []byte) error {
+	*c = Code(strings.ToUpper(string(text)))
+	return nil
+}
+
+type Product struct {
+	Name string `csv:"name"`
+	Code Code   `csv:"code"`
+}
+
+func TestUnmarshalWithPointerReceiver(t *testing.T) {
+	const data = `name,code
+Pen,ab12`
+	var products []*Product
+	var err = csv.Unmarshal([]byte(data), &products)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if products[0].Code != "AB12" {
+		t.Errorf("UnmarshalText is not called for a struct pointer slice, get %s", products[0].Code)
+		return
+	}
+
+	var values []Product
+	err = csv.Unmarshal([]byte(data), &values)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if values[0].Code != "AB12" {
+		t.Errorf("UnmarshalText is not called for a struct slice, get %s", values[0].Code)
+		return
 	}
 }
 
@@ -107,6 +197,46 @@ func TestUnmarshalWithValidator(t *testing.T) {
 	}
 }
 
+func TestUnmarshalWithTypedValidator(t *testing.T) {
+	var persons []*PersonValidatingAge
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons, csv.Validator("age", validateAge))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].Age != 25 {
+		t.Errorf("valid ages are not unmarshaled")
+		return
+	}
+
+	err = csv.Unmarshal([]byte(invalidAgeCalendarCSV), &persons, csv.Validator("age", validateAge))
+	if err == nil || !strings.Contains(err.Error(), "invalid value 0") {
+		t.Errorf("expect an error of the invalid age, get %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+func TestUnmarshalWithRawValidator(t *testing.T) {
+	var validateDigits = func(v string) bool {
+		return strings.Trim(v, "0123456789") == ""
+	}
+	var persons []*PersonValidatingAge
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons, csv.RawValidator("age", validateDigits))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	err = csv.Unmarshal([]byte(`first_name,last_name,age,married,phone
+John,Smith,+25,true,1234567890`), &persons, csv.RawValidator("age", validateDigits))
+	if err == nil {
+		t.Errorf("raw validator is not applied")
+		return
+	}
+	t.Log(err)
+}
+
 func TestUnmarshalWithPrefixAndSuffix(t *testing.T) {
 	var persons []*Person
 	var err = csv.Unmarshal([]byte(calendarCSVWithPrefixAndSuffix), &persons,
@@ -132,8 +262,693 @@ func TestUnmarshalWithOverridenPrefixAndSuffix(t *testing.T) {
 	printPersons(t, persons)
 }
 
+func TestUnmarshalWithHeaderSeparator(t *testing.T) {
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(calendarCSVWithTabSeparatedHeader), &persons,
+		csv.HeaderSeparator('\t'))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].LastName != "Smith" || persons[1].Phone != "9876543210" {
+		t.Errorf("header separator is not used")
+		return
+	}
+	printPersons(t, persons)
+}
+
+func TestUnmarshalEmptyDocument(t *testing.T) {
+	for _, data := range []string{"", "\n", "   \n ", "first_name,last_name,age,married,phone", "first_name,last_name,age,married,phone\n"} {
+		var persons []*Person
+		var err = csv.Unmarshal([]byte(data), &persons)
+		if err != nil {
+			t.Errorf("failed to unmarshal %q: %v", data, err)
+			return
+		}
+		if persons == nil || len(persons) != 0 {
+			t.Errorf("result of %q is not an empty slice, get %v", data, persons)
+			return
+		}
+	}
+}
+
+func TestUnmarshalWithResult(t *testing.T) {
+	const data = `first_name,last_name,age,married,phone
+John,Smith,25,true,1234567890
+Mary,Jane,abc,false,9876543210
+Bob,Brown,30,false,12345
+Alice,White,28,true,1357924680`
+	var persons []*Person
+	result, err := csv.UnmarshalWithResult([]byte(data), &persons, csv.ContinueOnError(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result.Read != 4 || result.OK != 2 || result.Failed != 2 || len(result.Errors) != 2 {
+		t.Errorf("result is wrong, get %+v", result)
+		return
+	}
+	if result.Errors[0].Row != 2 || result.Errors[1].Row != 3 {
+		t.Errorf("rows of errors are wrong, get %v", result.Errors)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" || persons[1].FirstName != "Alice" {
+		t.Errorf("valid rows are not unmarshaled")
+		return
+	}
+	for _, err := range result.Errors {
+		t.Log(err)
+	}
+	printPersons(t, persons)
+
+	// Without ContinueOnError, the first failed row fails unmarshaling.
+	persons = nil
+	_, err = csv.UnmarshalWithResult([]byte(data), &persons)
+	if err == nil || !strings.HasPrefix(err.Error(), "csv: row 2: ") {
+		t.Errorf("expect an error of row 2, get %v", err)
+		return
+	}
+}
+
+func TestUnmarshalWithTextUnmarshalerError(t *testing.T) {
+	const data = `first_name,last_name,age,married,phone
+John,Smith,25,true,1234567890
+Bob,Brown,30,false,12345
+Alice,White,28,true,1357924680`
+	var persons []*Person
+	result, err := csv.UnmarshalWithResult([]byte(data), &persons, csv.ContinueOnError(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" || persons[1].FirstName != "Alice" {
+		t.Errorf("valid rows are not unmarshaled")
+		return
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 2 || !strings.Contains(result.Errors[0].Error(), "field Phone") {
+		t.Errorf("error of the invalid phone is wrong, get %v", result.Errors)
+		return
+	}
+	t.Log(result.Errors[0])
+}
+
+func TestUnmarshalWithValidateHeader(t *testing.T) {
+	var validate = func(header []string) error {
+		for _, required := range []string{"first_name", "last_name", "phone"} {
+			var found = false
+			for _, name := range header {
+				if name == required {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("column %s is missing", required)
+			}
+		}
+		return nil
+	}
+
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons, csv.ValidateHeader(validate))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	const missingPhoneCSV = `first_name,last_name,age,married
+John,Smith,25,true`
+	persons = nil
+	err = csv.Unmarshal([]byte(missingPhoneCSV), &persons, csv.ValidateHeader(validate))
+	if err == nil || !strings.Contains(err.Error(), "column phone is missing") {
+		t.Errorf("expect an error of the missing column, get %v", err)
+		return
+	}
+	if len(persons) != 0 {
+		t.Errorf("rows are unmarshaled with an invalid header")
+		return
+	}
+	t.Log(err)
+}
+
+type Post struct {
+	ID     int    `csv:"id"`
+	Query  string `csv:"query,decode=url"`
+	Markup string `csv:"markup,decode=html"`
+}
+
+func TestUnmarshalWithDecode(t *testing.T) {
+	const data = `id,query,markup
+1,hello%20world%2C+again,&lt;b&gt;Tom &amp; Jerry&lt;/b&gt;`
+	var posts []*Post
+	var err = csv.Unmarshal([]byte(data), &posts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(posts) != 1 || posts[0].Query != "hello world, again" || posts[0].Markup != "<b>Tom & Jerry</b>" {
+		t.Errorf("fields are not decoded, get %+v", posts[0])
+		return
+	}
+	t.Logf("%+v", posts[0])
+}
+
+type Sale struct {
+	Revenue float64 `csv:"'Revenue, USD',positive"`
+	Date    string  `csv:"Date"`
+}
+
+func validatePositive(v interface{}) bool {
+	return v.(float64) > 0
+}
+
+func TestUnmarshalWithSeparatorInHeader(t *testing.T) {
+	const data = `"Revenue, USD",Date
+1.5,2018-01-02`
+	var sales []*Sale
+	var err = csv.Unmarshal([]byte(data), &sales, csv.Validator("positive", validatePositive))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(sales) != 1 || sales[0].Revenue != 1.5 || sales[0].Date != "2018-01-02" {
+		t.Errorf("fields are not unmarshaled, get %+v", sales[0])
+		return
+	}
+	t.Logf("%+v", sales[0])
+
+	// The validator is applied to the quoted column.
+	err = csv.Unmarshal([]byte(`"Revenue, USD",Date
+-1,2018-01-02`), &sales, csv.Validator("positive", validatePositive))
+	if err == nil {
+		t.Errorf("validator is not applied")
+		return
+	}
+	t.Log(err)
+
+	// Marshaling writes the quoted header back.
+	output, err := csv.Marshal([]Sale{{Revenue: 1.5, Date: "2018-01-02"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(output) != data {
+		t.Errorf("output is wrong, expect %q, get %q", data, output)
+	}
+}
+
+type QuotedTag struct {
+	Value string `csv:"'it''s'"`
+}
+
+func TestUnmarshalWithQuotedTag(t *testing.T) {
+	var values []*QuotedTag
+	var err = csv.Unmarshal([]byte("it's\nyes"), &values)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(values) != 1 || values[0].Value != "yes" {
+		t.Errorf("escaped quote in tag is not parsed")
+		return
+	}
+
+	type Unclosed struct {
+		Value string `csv:"'Revenue, USD"`
+	}
+	var unclosed []*Unclosed
+	err = csv.Unmarshal([]byte("a\nb"), &unclosed)
+	if err == nil {
+		t.Errorf("unclosed quote in tag is not reported")
+		return
+	}
+	t.Log(err)
+}
+
+func TestUnmarshalWithBOM(t *testing.T) {
+	var persons []*Person
+	var err = csv.Unmarshal([]byte("\ufeff"+calendarCSV), &persons)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" {
+		t.Errorf("first column is not unmarshaled")
+		return
+	}
+
+	// UTF-16 with a BOM.
+	data, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte(calendarCSV))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	persons = nil
+	err = csv.Unmarshal(data, &persons, csv.EncodingName("utf-16le"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" {
+		t.Errorf("first column is not unmarshaled from UTF-16")
+		return
+	}
+	printPersons(t, persons)
+}
+
+func TestUnmarshalWithHeaderCaseInsensitive(t *testing.T) {
+	const data = `First_Name,LAST_NAME,Age,Married,Phone
+John,Smith,25,true,1234567890`
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(data), &persons)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if persons[0].FirstName != "" || persons[0].Age != 0 {
+		t.Errorf("header names are matched ignoring case by default")
+		return
+	}
+
+	persons = nil
+	err = csv.Unmarshal([]byte(data), &persons, csv.HeaderCaseInsensitive(true))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if persons[0].FirstName != "John" || persons[0].LastName != "Smith" || persons[0].Age != 25 || !persons[0].Married {
+		t.Errorf("person is wrong, get %+v", *persons[0])
+		return
+	}
+}
+
+func TestUnmarshalWithUnknownColumns(t *testing.T) {
+	const data = `first_name,last_name,nickname,age,married,phone
+John,Smith,Johnny,25,true,1234567890`
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(data), &persons)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	persons = nil
+	err = csv.Unmarshal([]byte(data), &persons, csv.DisallowUnknownColumns(true))
+	if err == nil || !strings.Contains(err.Error(), "unknown column nickname") {
+		t.Errorf("unknown column is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+type Supplier struct {
+	Name  string `csv:"name,required"`
+	Phone string `csv:"phone,required"`
+	Email string `csv:"email"`
+}
+
+func TestUnmarshalWithRequiredColumns(t *testing.T) {
+	var suppliers []*Supplier
+	var err = csv.Unmarshal([]byte("name,email\nJohn,john@example.com"), &suppliers)
+	if err == nil || !strings.Contains(err.Error(), "missing required columns phone") {
+		t.Errorf("missing column is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+
+	// Empty fields in required columns are allowed.
+	suppliers = nil
+	err = csv.Unmarshal([]byte("name,phone\nJohn,"), &suppliers)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if suppliers[0].Name != "John" || suppliers[0].Phone != "" {
+		t.Errorf("supplier is wrong, get %+v", *suppliers[0])
+	}
+
+	// A header without data rows is checked too.
+	err = csv.Unmarshal([]byte("name\n"), &suppliers)
+	if err == nil || !strings.Contains(err.Error(), "missing required columns phone") {
+		t.Errorf("missing column in a header-only document is not reported, get error %v", err)
+		return
+	}
+	err = csv.Unmarshal([]byte("name,phone,fax\n"), &suppliers, csv.DisallowUnknownColumns(true))
+	if err == nil || !strings.Contains(err.Error(), "unknown column fax") {
+		t.Errorf("unknown column in a header-only document is not reported, get error %v", err)
+		return
+	}
+}
+
+type Player struct {
+	Name   string  `csv:"name,default=anonymous"`
+	Age    int     `csv:"age,default=18"`
+	Score  float64 `csv:"score,default=1.5"`
+	Active bool    `csv:"active,default=true"`
+	Level  *int    `csv:"level,default=1"`
+	Team   *string `csv:"team"`
+}
+
+func TestUnmarshalWithDefault(t *testing.T) {
+	const data = `name,age,score,active,level,team
+,,,,,
+Bob,25,3,false,2,red`
+	var players []*Player
+	var err = csv.Unmarshal([]byte(data), &players)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var p = players[0]
+	if p.Name != "anonymous" || p.Age != 18 || p.Score != 1.5 || !p.Active || p.Level == nil || *p.Level != 1 || p.Team != nil {
+		t.Errorf("default values are not used, get %+v", *p)
+		return
+	}
+	p = players[1]
+	if p.Name != "Bob" || p.Age != 25 || p.Score != 3 || p.Active || *p.Level != 2 || *p.Team != "red" {
+		t.Errorf("values are wrong, get %+v", *p)
+		return
+	}
+}
+
+func TestUnmarshalWithLongRow(t *testing.T) {
+	const data = `first_name,last_name,age,married,phone
+John,Smith,25,true,1234567890
+Mary,Jane,23,false,9876543210,extra`
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(data), &persons)
+	if err == nil || !strings.Contains(err.Error(), "row 2: 6 fields found but the header has 5 columns") {
+		t.Errorf("long row is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+func TestUnmarshalWithHeaderNames(t *testing.T) {
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(headerlessCalendarCSV), &persons,
+		csv.Header(false),
+		csv.HeaderNames([]string{"first_name", "last_name", "age", "married", "phone"}))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(persons) != 2 || persons[0].FirstName != "John" || persons[1].Age != 23 {
+		t.Errorf("header names are not used")
+		return
+	}
+	printPersons(t, persons)
+}
+
+type Greeting struct {
+	ID   int    `csv:"id"`
+	Name string `csv:"name"`
+	Text string `csv:"text,encoding=shift_jis"`
+}
+
+func TestUnmarshalWithFieldEncoding(t *testing.T) {
+	text, err := japanese.ShiftJIS.NewEncoder().String("こんにちは")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// A UTF-8 document with a Shift-JIS column.
+	var data = "id,name,text\n1,café,\"" + text + "\"\n2,naïve," + text
+
+	var greetings []*Greeting
+	err = csv.Unmarshal([]byte(data), &greetings)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var expected = []*Greeting{{1, "café", "こんにちは"}, {2, "naïve", "こんにちは"}}
+	if !reflect.DeepEqual(greetings, expected) {
+		t.Errorf("fields are not decoded, expect %+v, get %+v", *expected[0], *greetings[0])
+		return
+	}
+	for _, greeting := range greetings {
+		t.Logf("Greeting #%d: %s, %s", greeting.ID, greeting.Name, greeting.Text)
+	}
+
+	// Raw bytes cannot be recovered from a UTF-16 document.
+	err = csv.Unmarshal([]byte(data), &greetings, csv.EncodingName("utf-16le"))
+	if err == nil {
+		t.Error("document encoding incompatible with ASCII is not reported")
+		return
+	}
+}
+
+type EncodedPair struct {
+	A string `csv:"a"`
+	B string `csv:"b,encoding=shift_jis"`
+}
+
+type Pair struct {
+	A string `csv:"a"`
+	B string `csv:"b"`
+}
+
+func TestUnmarshalWithFieldEncodingAndOtherSettings(t *testing.T) {
+	// Invalid UTF-8 is reported with or without fields with the encoding option.
+	const invalid = "a,b\n\xff\xfe,x\n"
+	var pairs []*Pair
+	var err = csv.Unmarshal([]byte(invalid), &pairs, csv.RequireValidUTF8(true))
+	if err == nil || !strings.Contains(err.Error(), "invalid UTF-8 in field") {
+		t.Errorf("invalid UTF-8 is not reported, get error %v", err)
+		return
+	}
+	var encodedPairs []*EncodedPair
+	err = csv.Unmarshal([]byte(invalid), &encodedPairs, csv.RequireValidUTF8(true))
+	if err == nil || !strings.Contains(err.Error(), "invalid UTF-8 in field") {
+		t.Errorf("invalid UTF-8 is not reported with a field encoding, get error %v", err)
+		return
+	}
+
+	// Decoded bytes are counted with MaxTotalBytes.
+	const accented = "a,b\né,x\n"
+	err = csv.Unmarshal([]byte(accented), &pairs, csv.MaxTotalBytes(6))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = csv.Unmarshal([]byte(accented), &encodedPairs, csv.MaxTotalBytes(6))
+	if err != nil {
+		t.Errorf("decoded bytes are not counted with a field encoding, get error %v", err)
+		return
+	}
+	err = csv.Unmarshal([]byte(accented), &encodedPairs, csv.MaxTotalBytes(2))
+	if err != csv.ErrResultTooLarge {
+		t.Errorf("expect ErrResultTooLarge, get %v", err)
+		return
+	}
+}
+
+type Tags struct {
+	ID    int      `csv:"id"`
+	Name  string   `csv:"name"`
+	Group string   `csv:"group"`
+	Tags  []string `csv:",overflow"`
+}
+
+func TestUnmarshalWithOverflow(t *testing.T) {
+	const data = `id,name,group
+1,aaa,x,tag1,tag2
+2,bbb,y`
+	var tags []*Tags
+	var err = csv.Unmarshal([]byte(data), &tags)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(tags) != 2 || strings.Join(tags[0].Tags, "|") != "tag1|tag2" || len(tags[1].Tags) != 0 {
+		t.Errorf("overflow columns are not captured")
+		return
+	}
+	for i, tag := range tags {
+		t.Logf("Tags #%d: { ID: %d, Name: %s, Group: %s, Tags: [%s] }", i, tag.ID, tag.Name, tag.Group, strings.Join(tag.Tags, ", "))
+	}
+}
+
+func TestUnmarshalWithProgress(t *testing.T) {
+	var calls = make([]int, 0)
+	var persons []*Person
+	var err = csv.Unmarshal([]byte(calendarCSV), &persons,
+		csv.Progress(1, func(records int) { calls = append(calls, records) }))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(calls) != 2 || calls[0] != 1 || calls[1] != 2 {
+		t.Errorf("progress is reported wrongly, get %v", calls)
+	}
+}
+
+func TestUnmarshalContext(t *testing.T) {
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var persons []*Person
+	var err = csv.UnmarshalContext(ctx, []byte(calendarCSV), &persons,
+		csv.Progress(1, func(records int) { cancel() }))
+	if err != context.Canceled {
+		t.Errorf("expect context.Canceled, get %v", err)
+		return
+	}
+	if len(persons) != 1 || persons[0].FirstName != "John" {
+		t.Errorf("rows unmarshaled before cancelling are wrong, get %d rows", len(persons))
+		return
+	}
+	printPersons(t, persons)
+
+	// Cancelling stops scanning the rest of the document, which would fail here.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var suppliers []*Supplier
+	err = csv.UnmarshalContext(ctx, []byte("name,phone\nJohn,123\nMary,456\n\"broken"), &suppliers,
+		csv.FieldTransform(func(col int, field string) string {
+			if field == "John" {
+				cancel()
+			}
+			return field
+		}))
+	if err != context.Canceled {
+		t.Errorf("expect context.Canceled, get %v", err)
+		return
+	}
+	if len(suppliers) != 1 || suppliers[0].Name != "John" {
+		t.Errorf("rows unmarshaled before cancelling are wrong, get %d rows", len(suppliers))
+		return
+	}
+}
+
 func printPersons(t *testing.T, persons []*Person) {
 	for i, person := range persons {
 		t.Logf("Person #%d: { Name: %s %s, Age: %d, Married: %v, Phone: %s }", i, person.FirstName, person.LastName, person.Age, person.Married, person.Phone)
 	}
 }
+
+type Sensor struct {
+	Level    int8    `csv:"level"`
+	Count    uint8   `csv:"count"`
+	Strength float32 `csv:"strength"`
+}
+
+func TestUnmarshalWithIntOverflow(t *testing.T) {
+	const data = `level,count,strength
+300,-1,1e39`
+	var sensors []*Sensor
+	var err = csv.Unmarshal([]byte(data), &sensors)
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("overflow is not reported, get error %v", err)
+		return
+	}
+
+	sensors = nil
+	err = csv.Unmarshal([]byte(data), &sensors, csv.IntOverflow(csv.OverflowClamp))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if sensors[0].Level != math.MaxInt8 || sensors[0].Count != 0 || sensors[0].Strength != math.MaxFloat32 {
+		t.Errorf("values are not clamped, get %+v", *sensors[0])
+		return
+	}
+
+	sensors = nil
+	err = csv.Unmarshal([]byte(data), &sensors, csv.IntOverflow(csv.OverflowWrap))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if sensors[0].Level != 44 || sensors[0].Count != math.MaxUint8 || !math.IsInf(float64(sensors[0].Strength), 1) {
+		t.Errorf("values are not wrapped, get %+v", *sensors[0])
+		return
+	}
+}
+
+type Account struct {
+	Name      string     `csv:"name"`
+	CreatedAt time.Time  `csv:"created_at,layout=2006-01-02"`
+	ClosedAt  *time.Time `csv:"closed_at,layout=2006-01-02"`
+}
+
+func TestUnmarshalWithTimeLayout(t *testing.T) {
+	const data = `name,created_at,closed_at
+John,2021-03-04,
+Bob,2020-01-02,2021-05-06`
+	var accounts []*Account
+	var err = csv.Unmarshal([]byte(data), &accounts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !accounts[0].CreatedAt.Equal(time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)) || accounts[0].ClosedAt != nil {
+		t.Errorf("times of John are wrong, get %+v", *accounts[0])
+		return
+	}
+	if accounts[1].ClosedAt == nil || !accounts[1].ClosedAt.Equal(time.Date(2021, 5, 6, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("closing time of Bob is wrong, get %v", accounts[1].ClosedAt)
+		return
+	}
+
+	marshaled, err := csv.Marshal(accounts)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(marshaled) != data {
+		t.Errorf("marshaled accounts are wrong, get %q", marshaled)
+		return
+	}
+
+	accounts = nil
+	err = csv.Unmarshal([]byte("name,created_at,closed_at\nJohn,2021-13-04,"), &accounts)
+	if err == nil || !strings.Contains(err.Error(), "field CreatedAt") || !strings.Contains(err.Error(), "2021-13-04") {
+		t.Errorf("invalid date is not reported, get error %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+type Subscriber struct {
+	Name string  `csv:"name"`
+	Age  *int    `csv:"age"`
+	Nick *string `csv:"nick"`
+}
+
+func TestUnmarshalWithPointerFields(t *testing.T) {
+	const data = `name,age,nick
+John,,Johnny
+Bob,25,`
+	var subscribers []*Subscriber
+	var err = csv.Unmarshal([]byte(data), &subscribers)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if subscribers[0].Age != nil || subscribers[0].Nick == nil || *subscribers[0].Nick != "Johnny" {
+		t.Errorf("fields of John are wrong, get %+v", *subscribers[0])
+		return
+	}
+	if subscribers[1].Age == nil || *subscribers[1].Age != 25 || subscribers[1].Nick != nil {
+		t.Errorf("fields of Bob are wrong, get %+v", *subscribers[1])
+		return
+	}
+
+	subscribers = nil
+	err = csv.Unmarshal([]byte("name,age,nick\nJohn,x,"), &subscribers)
+	if err == nil || !strings.Contains(err.Error(), "field Age") {
+		t.Errorf("invalid age is not reported, get error %v", err)
+		return
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	var data = []byte(calendarCSV)
+	for i := 0; i < b.N; i++ {
+		var persons []*Person
+		var err = csv.Unmarshal(data, &persons)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}